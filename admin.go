@@ -0,0 +1,28 @@
+package grpctest
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// startAdmin starts the admin server on its own random port.
+// It uses the same transport security as the main server.
+//
+// Note: must be called with s.mu held.
+func (s *Server) startAdmin() error {
+	listener, err := newLocalListener()
+	if err != nil {
+		return err
+	}
+	s.AdminURL = listener.Addr().String()
+
+	var opts []grpc.ServerOption
+	if s.useTLS && s.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.TLS)))
+	}
+
+	s.adminServer = grpc.NewServer(opts...)
+	s.Config.adminServices(s.adminServer)
+	serve(s.adminServer, listener, !s.Config.quiet)
+	return nil
+}
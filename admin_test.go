@@ -0,0 +1,55 @@
+package grpctest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestWithAdminServices(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithAdminServices(func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, health.NewServer())
+	}))
+	defer server.Close()
+
+	if server.AdminURL == "" || server.AdminURL == server.URL {
+		t.Fatalf("expected a distinct admin URL, got %q (URL: %q)", server.AdminURL, server.URL)
+	}
+
+	conn, err := grpc.NewClient(server.AdminURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected SERVING, got %v", resp.Status)
+	}
+
+	// Business services are not served on the admin port
+	_, err = pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "World"})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented, got %v", err)
+	}
+
+	// Both servers are shut down by Close
+	server.Close()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err == nil {
+		t.Error("expected error after close, got nil")
+	}
+}
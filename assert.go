@@ -0,0 +1,143 @@
+package grpctest
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// leakTimeout is the time given to goroutines to exit before reporting a leak.
+const leakTimeout = time.Second
+
+// leakPackages lists the packages whose goroutines are checked by [AssertNoLeaks].
+var leakPackages = []string{
+	"github.com/loicsikidi/grpctest.",
+	"google.golang.org/grpc.",
+	"google.golang.org/grpc/",
+}
+
+// AssertNoLeaks fails the test if goroutines started by grpctest or gRPC are still running.
+// Goroutines are given a short grace period to exit before being reported.
+// It is meant to be deferred (or registered with tb.Cleanup) after closing the servers
+// and client connections of a test:
+//
+//	defer grpctest.AssertNoLeaks(t)
+//	server := grpctest.NewServer(registerFunc)
+//	defer server.Close()
+//
+// Note: it inspects all goroutines of the process, so it must not be used
+// in parallel tests running their own servers.
+func AssertNoLeaks(tb testing.TB) {
+	tb.Helper()
+
+	deadline := time.Now().Add(leakTimeout)
+	for {
+		leaks := leakedGoroutines()
+		if len(leaks) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			tb.Errorf("grpctest: found %d leaked goroutine(s):\n\n%s", len(leaks), strings.Join(leaks, "\n\n"))
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// leakedGoroutines returns the stacks of the goroutines (other than the current one)
+// running code from one of [leakPackages].
+func leakedGoroutines() []string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var leaks []string
+	// The first stack is the current goroutine's
+	stacks := bytes.Split(buf, []byte("\n\n"))
+	for _, stack := range stacks[1:] {
+		for _, pkg := range leakPackages {
+			if bytes.Contains(stack, []byte(pkg)) {
+				leaks = append(leaks, string(stack))
+				break
+			}
+		}
+	}
+	return leaks
+}
+
+// EqualProto fails the test if the got and want messages are not equal according to [proto.Equal],
+// reporting a line diff of their text representations.
+// Unlike == or reflect.DeepEqual, it ignores the internal state of the messages.
+//
+// Example:
+//
+//	reply, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+//	grpctest.EqualProto(t, reply, &pb.HelloReply{Message: "Hello World"})
+func EqualProto(tb testing.TB, got, want proto.Message) {
+	tb.Helper()
+
+	if proto.Equal(got, want) {
+		return
+	}
+	tb.Errorf("grpctest: messages differ (-want +got):\n%s", diffLines(formatProto(want), formatProto(got)))
+}
+
+// formatProto returns the text representation of m, prefixed with its type.
+func formatProto(m proto.Message) string {
+	if m == nil {
+		return "<nil>"
+	}
+	text := prototext.MarshalOptions{Multiline: true, EmitUnknown: true}.Format(m)
+	return string(m.ProtoReflect().Descriptor().FullName()) + " {\n" + text + "}"
+}
+
+// diffLines returns a line diff of want and got, where lines only in want are prefixed
+// with "-", lines only in got with "+", and common lines with a space.
+func diffLines(want, got string) string {
+	a := strings.Split(strings.TrimSpace(want), "\n")
+	b := strings.Split(strings.TrimSpace(got), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			diff.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			diff.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+	return diff.String()
+}
@@ -0,0 +1,86 @@
+package grpctest_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAssertNoLeaks(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server.Close()
+	grpctest.AssertNoLeaks(t)
+}
+
+func TestAssertNoLeaksDetectsRunningServer(t *testing.T) {
+	server := grpctest.NewServer(nil)
+	defer server.Close()
+
+	recorder := &errorRecorder{TB: t}
+	grpctest.AssertNoLeaks(recorder)
+	if !recorder.failed {
+		t.Error("expected the running server to be reported as a leak")
+	}
+}
+
+// errorRecorder is a [testing.TB] recording whether Errorf was called, and the last message.
+type errorRecorder struct {
+	testing.TB
+	failed  bool
+	message string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...any) {
+	r.failed = true
+	r.message = fmt.Sprintf(format, args...)
+}
+
+func TestEqualProto(t *testing.T) {
+	tests := []struct {
+		name       string
+		got        proto.Message
+		want       proto.Message
+		wantFailed bool
+	}{
+		{name: "equal", got: &pb.HelloReply{Message: "Hello World"}, want: &pb.HelloReply{Message: "Hello World"}},
+		{name: "empty", got: &pb.HelloReply{}, want: &pb.HelloReply{}},
+		{name: "different field", got: &pb.HelloReply{Message: "Hello"}, want: &pb.HelloReply{Message: "Hello World"}, wantFailed: true},
+		{name: "different type", got: &pb.HelloRequest{Name: "World"}, want: &pb.HelloReply{Message: "World"}, wantFailed: true},
+		{name: "nil", got: nil, want: &pb.HelloReply{}, wantFailed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &errorRecorder{TB: t}
+			grpctest.EqualProto(recorder, tt.got, tt.want)
+			if failed := recorder.failed; failed != tt.wantFailed {
+				t.Errorf("expected failure %v, got %v (%s)", tt.wantFailed, failed, recorder.message)
+			}
+		})
+	}
+}
+
+func TestEqualProtoDiff(t *testing.T) {
+	recorder := &errorRecorder{TB: t}
+	grpctest.EqualProto(recorder, &pb.HelloReply{Message: "Hello"}, &pb.HelloReply{Message: "Hello World"})
+
+	for _, want := range []string{"-want +got", `- message:`, `"Hello World"`, `+ message:`, `"Hello"`} {
+		if !strings.Contains(recorder.message, want) {
+			t.Errorf("expected diff to contain %q, got:\n%s", want, recorder.message)
+		}
+	}
+}
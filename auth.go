@@ -0,0 +1,30 @@
+package grpctest
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// AuthedClientConn returns a new client connection to the test server attaching
+// an "authorization: Bearer <token>" metadata to every RPC, like real clients do.
+// The token is sent in plain text mode too, so that auth interceptors can be tested on any server.
+//
+// Like [Server.ClientConn] with options, a new connection is created on each call,
+// and it is closed when the server is closed.
+func (s *Server) AuthedClientConn(token string) grpc.ClientConnInterface {
+	return s.ClientConn(grpc.WithPerRPCCredentials(bearerToken(token)))
+}
+
+// bearerToken implements [credentials.PerRPCCredentials] with a static bearer token.
+type bearerToken string
+
+// GetRequestMetadata returns the authorization metadata.
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity returns false to allow sending the token in plain text mode.
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
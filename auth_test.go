@@ -0,0 +1,44 @@
+package grpctest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAuthedClientConn(t *testing.T) {
+	register := func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				return &pb.HelloReply{Message: md.Get("authorization")[0]}, nil
+			},
+		})
+	}
+
+	for _, tc := range []struct {
+		name      string
+		newServer func(func(*grpc.Server), ...grpctest.Option) *grpctest.Server
+	}{
+		{name: "plain text", newServer: grpctest.NewServer},
+		{name: "TLS", newServer: grpctest.NewTLSServer},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := tc.newServer(register)
+			defer server.Close()
+
+			client := pb.NewGreeterClient(server.AuthedClientConn("secret"))
+			reply, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reply.Message != "Bearer secret" {
+				t.Errorf("expected authorization %q, got %q", "Bearer secret", reply.Message)
+			}
+		})
+	}
+}
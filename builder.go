@@ -0,0 +1,84 @@
+package grpctest
+
+import (
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// Builder builds a [Server] with a fluent API.
+// It gives a single place to discover the available options and
+// validates incompatible combinations before starting the server.
+//
+// Example:
+//
+//	server := grpctest.NewBuilder().
+//		WithTLS().
+//		WithReflection().
+//		Register(func(s *grpc.Server) {
+//			proto.RegisterGreeterServer(s, &myGreeterImpl{})
+//		}).
+//		Build()
+//	defer server.Close()
+type Builder struct {
+	registerFunc func(*grpc.Server)
+	opts         []Option
+	tls          bool
+}
+
+// NewBuilder returns a new [Builder].
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Register sets the function registering gRPC services on the server.
+func (b *Builder) Register(registerFunc func(*grpc.Server)) *Builder {
+	b.registerFunc = registerFunc
+	return b
+}
+
+// With adds arbitrary options to the server.
+func (b *Builder) With(opts ...Option) *Builder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// WithTLS starts the server with TLS enabled (see [Server.StartTLS]).
+func (b *Builder) WithTLS() *Builder {
+	b.tls = true
+	return b
+}
+
+// WithReflection is equivalent to [WithReflection].
+func (b *Builder) WithReflection() *Builder {
+	return b.With(WithReflection())
+}
+
+// WithChannelz is equivalent to [WithChannelz].
+func (b *Builder) WithChannelz() *Builder {
+	return b.With(WithChannelz())
+}
+
+// WithLogging is equivalent to [WithLogging].
+func (b *Builder) WithLogging(tb testing.TB) *Builder {
+	return b.With(WithLogging(tb))
+}
+
+// WithMaxRecvMsgSize is equivalent to [WithMaxRecvMsgSize].
+func (b *Builder) WithMaxRecvMsgSize(n int) *Builder {
+	return b.With(WithMaxRecvMsgSize(n))
+}
+
+// Build validates the configuration, then creates and starts the server.
+//
+// Note: this method panics if the configuration is invalid or if the server fails to start.
+func (b *Builder) Build() *Server {
+	// The configuration is validated by Start and StartTLS
+	s := NewUnstartedServer(b.registerFunc, b.opts...)
+	if b.tls {
+		s.StartTLS()
+	} else {
+		s.Start()
+	}
+	return s
+}
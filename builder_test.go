@@ -0,0 +1,84 @@
+package grpctest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+)
+
+func TestBuilder(t *testing.T) {
+	server := grpctest.NewBuilder().
+		WithTLS().
+		WithReflection().
+		WithMaxRecvMsgSize(1024).
+		Register(func(s *grpc.Server) {
+			pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+		}).
+		Build()
+	defer server.Close()
+
+	if server.Certificate() == nil {
+		t.Fatal("expected a TLS server")
+	}
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx := context.Background()
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "Builder"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Requests larger than the configured limit are rejected
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: string(make([]byte, 2048))}); err == nil {
+		t.Error("expected error for oversized request, got nil")
+	}
+
+	// Reflection service is registered
+	stream, err := reflectionpb.NewServerReflectionClient(server.ClientConn()).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.GetListServicesResponse().GetService()) == 0 {
+		t.Error("expected reflection to list services")
+	}
+}
+
+func TestBuilderInvalidConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *grpctest.Builder
+	}{
+		{
+			name:    "negative max receive message size",
+			builder: grpctest.NewBuilder().WithMaxRecvMsgSize(-1),
+		},
+		{
+			name:    "certificate options without TLS",
+			builder: grpctest.NewBuilder().With(grpctest.WithCertClock(time.Now)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Error("expected Build to panic")
+				}
+			}()
+			tt.builder.Build()
+		})
+	}
+}
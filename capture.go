@@ -0,0 +1,415 @@
+package grpctest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip" // lets the server decompress gzip requests
+	"google.golang.org/grpc/encoding/proto"
+	"google.golang.org/grpc/mem"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/stats"
+)
+
+// EnablePeerCapture records the peer of each incoming RPC.
+// The peer of the last RPC is available through [Server.LastPeer].
+func (s *Server) EnablePeerCapture() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.capturePeer = true
+}
+
+// LastPeer returns the peer (address and transport auth info) of the last RPC
+// received by the server.
+// Returns nil if [Server.EnablePeerCapture] was not called or if no RPC has been received yet.
+func (s *Server) LastPeer() *peer.Peer {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.lastPeer
+}
+
+// EnableAuthInfoCapture records the transport auth info of each incoming RPC.
+// The auth info of the last RPC is available through [Server.LastAuthInfo].
+func (s *Server) EnableAuthInfoCapture() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.captureAuth = true
+}
+
+// LastAuthInfo returns the transport auth info of the last RPC received by the server.
+// For TLS servers, it is a [credentials.TLSInfo] holding the verified client certificate
+// chains (if any), which lets mTLS tests assert that the expected client certificate reached
+// the server without writing an interceptor.
+// Returns nil if [Server.EnableAuthInfoCapture] was not called, if no RPC has been received yet,
+// or if the last RPC was not authenticated by the transport (e.g., plaintext servers).
+func (s *Server) LastAuthInfo() credentials.AuthInfo {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.lastAuthInfo
+}
+
+// NegotiatedCipherSuite returns the cipher suite (e.g., [tls.TLS_AES_128_GCM_SHA256]) negotiated
+// by the last completed TLS handshake, so that security tests can assert only approved cipher
+// suites are used. It returns false if the server does not use TLS or if no handshake has completed yet.
+func (s *Server) NegotiatedCipherSuite() (uint16, bool) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.cipherSuite, s.handshaked
+}
+
+// recordConnectionState returns a [tls.Config.VerifyConnection] callback delegating to next (if any),
+// then recording the state of the handshake if it is accepted.
+func (s *Server) recordConnectionState(next func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if next != nil {
+			if err := next(cs); err != nil {
+				return err
+			}
+		}
+
+		s.stateMu.Lock()
+		defer s.stateMu.Unlock()
+		s.cipherSuite = cs.CipherSuite
+		s.handshaked = true
+		s.resumed = cs.DidResume
+		return nil
+	}
+}
+
+// LastHandshakeResumed reports whether the last completed TLS handshake resumed a previous session
+// (see [tls.ConnectionState.DidResume]), to verify that clients reuse TLS sessions across connections,
+// or that [WithSessionTicketsDisabled] forces full handshakes.
+// It returns false if the server does not use TLS or if no handshake has completed yet.
+//
+// Note: the client returned by [Server.ClientConn] has no session cache, thus never resumes sessions.
+func (s *Server) LastHandshakeResumed() bool {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.resumed
+}
+
+// EnableTiming records the duration of the handler of each RPC, per full method.
+// Durations are available through [Server.Timings].
+func (s *Server) EnableTiming() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.captureTiming = true
+}
+
+// Timings returns a copy of the handler durations recorded per full method
+// (e.g., "/hello.Greeter/SayHello"), in the order the RPCs completed.
+// Returns an empty map if [Server.EnableTiming] was not called or if no RPC has completed yet.
+//
+// This is useful to assert latency percentiles in performance regression tests.
+func (s *Server) Timings() map[string][]time.Duration {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	timings := make(map[string][]time.Duration, len(s.timings))
+	for method, durations := range s.timings {
+		timings[method] = slices.Clone(durations)
+	}
+	return timings
+}
+
+// handlerWatchdog reports the handlers running longer than max to tb.
+type handlerWatchdog struct {
+	tb  testing.TB
+	max time.Duration
+}
+
+// SetMaxHandlerDuration makes the server fail the test with tb.Errorf whenever the handler
+// of an RPC runs longer than d, turning slow handlers into test failures rather than
+// merely recording them like [Server.EnableTiming].
+// The watchdog is removed when the test completes, by [Server.Reset], or by passing a zero duration.
+//
+// Note: durations are measured with the server's clock (see [WithClock]).
+func (s *Server) SetMaxHandlerDuration(tb testing.TB, d time.Duration) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if d <= 0 {
+		s.watchdog = nil
+		return
+	}
+	watchdog := &handlerWatchdog{tb: tb, max: d}
+	s.watchdog = watchdog
+	tb.Cleanup(func() {
+		// Handlers completing after the test must not report to it
+		s.stateMu.Lock()
+		defer s.stateMu.Unlock()
+		if s.watchdog == watchdog {
+			s.watchdog = nil
+		}
+	})
+}
+
+// recordTiming records the duration of an RPC handler started at start, if timing is enabled,
+// and reports it to the watchdog if it is too long.
+func (s *Server) recordTiming(fullMethod string, start time.Time) {
+	elapsed := s.Config.clock().since(start)
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.watchdog != nil && elapsed > s.watchdog.max {
+		s.watchdog.tb.Errorf("grpctest: handler of %s took %v, more than %v", fullMethod, elapsed, s.watchdog.max)
+	}
+	if !s.captureTiming {
+		return
+	}
+	if s.timings == nil {
+		s.timings = make(map[string][]time.Duration)
+	}
+	s.timings[fullMethod] = append(s.timings[fullMethod], elapsed)
+}
+
+// streamStats counts the messages received and sent by the server on a stream.
+type streamStats struct {
+	recv atomic.Int64
+	sent atomic.Int64
+}
+
+// StreamStats returns the number of messages received and sent by the server on the last stream
+// of the given full method (e.g., "/hello.Greeter/SayHelloStream"), to assert the flow of streaming
+// RPCs without instrumenting the handler. Counts are updated live while the stream is running.
+// Returns zeros if no stream of the method has been received yet.
+func (s *Server) StreamStats(fullMethod string) (recv, sent int) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	stats, ok := s.streamStats[fullMethod]
+	if !ok {
+		return 0, 0
+	}
+	return int(stats.recv.Load()), int(stats.sent.Load())
+}
+
+// countMessages returns ss wrapped to count its messages, as the last stream of fullMethod.
+func (s *Server) countMessages(ss grpc.ServerStream, fullMethod string) grpc.ServerStream {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	stats := &streamStats{}
+	if s.streamStats == nil {
+		s.streamStats = make(map[string]*streamStats)
+	}
+	s.streamStats[fullMethod] = stats
+	return &countingStream{ServerStream: ss, stats: stats}
+}
+
+// countingStream wraps a [grpc.ServerStream] to count the messages successfully received and sent.
+type countingStream struct {
+	grpc.ServerStream
+	stats *streamStats
+}
+
+// SendMsg sends m, counting it on success.
+func (s *countingStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.stats.sent.Add(1)
+	}
+	return err
+}
+
+// RecvMsg receives m, counting it on success.
+func (s *countingStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.stats.recv.Add(1)
+	}
+	return err
+}
+
+// capture records the information of an incoming RPC.
+func (s *Server) capture(ctx context.Context) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return
+	}
+	if s.capturePeer {
+		s.lastPeer = p
+	}
+	if s.captureAuth {
+		s.lastAuthInfo = p.AuthInfo
+	}
+}
+
+// ActiveStreams returns the full method names of the streams currently open on the server,
+// sorted, with one entry per stream (e.g., ["/hello.Greeter/SayHelloStream", "/hello.Greeter/SayHelloStream"]).
+// This helps pinpoint a stream that isn't closing when a streaming test hangs.
+func (s *Server) ActiveStreams() []string {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	var streams []string
+	for method, n := range s.activeStreams {
+		for range n {
+			streams = append(streams, method)
+		}
+	}
+	slices.Sort(streams)
+	return streams
+}
+
+// trackStream records a stream as active until the returned function is called.
+func (s *Server) trackStream(fullMethod string) func() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.activeStreams == nil {
+		s.activeStreams = make(map[string]int)
+	}
+	s.activeStreams[fullMethod]++
+	return func() {
+		s.stateMu.Lock()
+		defer s.stateMu.Unlock()
+
+		if s.activeStreams[fullMethod]--; s.activeStreams[fullMethod] == 0 {
+			delete(s.activeStreams, fullMethod)
+		}
+	}
+}
+
+// TotalCalls returns the number of RPCs (unary and streaming, across all methods) received by the server,
+// including the ones rejected by injected errors, rate limits, etc.
+// The count is cleared by [Server.Reset].
+func (s *Server) TotalCalls() int {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	total := 0
+	for _, n := range s.calls {
+		total += n
+	}
+	return total
+}
+
+// CallCount returns the number of RPCs to fullMethod (e.g., "/hello.Greeter/SayHello") received
+// by the server, including the ones rejected by injected errors, rate limits, etc.
+// Each attempt of a retried RPC is counted, so that tests can assert that the retry policy
+// of the client behaved as configured. The count is cleared by [Server.Reset].
+func (s *Server) CallCount(fullMethod string) int {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.calls[fullMethod]
+}
+
+// countCall records an RPC received by the server.
+func (s *Server) countCall(fullMethod string) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.calls == nil {
+		s.calls = make(map[string]int)
+	}
+	s.calls[fullMethod]++
+}
+
+// LastRawRequest returns a copy of the raw wire bytes of the last request message received by the server.
+// Returns nil if the server was not created with [WithRawRequestCapture] or if no message has been received yet.
+func (s *Server) LastRawRequest() []byte {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return bytes.Clone(s.lastRawReq)
+}
+
+// capturingCodec wraps the server codec to record the raw bytes of request messages.
+type capturingCodec struct {
+	encoding.CodecV2
+	server *Server
+}
+
+// capturingCodec returns a proto codec recording the raw bytes of the requests received by s.
+func (s *Server) capturingCodec() encoding.CodecV2 {
+	return &capturingCodec{
+		CodecV2: encoding.GetCodecV2(proto.Name),
+		server:  s,
+	}
+}
+
+// Unmarshal records data before delegating to the wrapped codec.
+func (c *capturingCodec) Unmarshal(data mem.BufferSlice, v any) error {
+	raw := data.Materialize()
+	c.server.stateMu.Lock()
+	c.server.lastRawReq = raw
+	c.server.stateMu.Unlock()
+	return c.CodecV2.Unmarshal(data, v)
+}
+
+// LastClientHello returns the ClientHello of the last TLS handshake received by the server,
+// which reveals the cipher suites, server name (SNI) and application protocols (ALPN) offered by the client.
+// It is recorded even if the handshake fails, which helps diagnose TLS negotiation failures.
+// Returns nil if the server does not use TLS or if no handshake has been received yet.
+func (s *Server) LastClientHello() *tls.ClientHelloInfo {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.lastHello
+}
+
+// recordClientHello returns a [tls.Config.GetConfigForClient] callback recording the ClientHello,
+// then delegating to next (if any).
+func (s *Server) recordClientHello(next func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		s.stateMu.Lock()
+		s.lastHello = hello
+		s.stateMu.Unlock()
+
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+}
+
+// LastRequestCompression returns the compression algorithm (i.e. the grpc-encoding header) of the
+// last request received by the server, e.g., "gzip". Returns "" if the request was not compressed
+// or if no request has been received yet.
+//
+// This verifies the compression configuration of clients end-to-end (e.g., [grpc.UseCompressor]).
+// The gzip compressor is registered by this package, so that the server accepts gzip requests.
+func (s *Server) LastRequestCompression() string {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.lastCompress
+}
+
+// statsRecorder is a [stats.Handler] recording the information of incoming RPCs
+// which interceptors can't observe.
+type statsRecorder struct {
+	server *Server
+}
+
+// TagRPC returns ctx unchanged.
+func (r *statsRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC records the compression algorithm of the incoming requests.
+func (r *statsRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if header, ok := s.(*stats.InHeader); ok {
+		r.server.stateMu.Lock()
+		r.server.lastCompress = header.Compression
+		r.server.stateMu.Unlock()
+	}
+}
+
+// TagConn returns ctx unchanged.
+func (r *statsRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn does nothing.
+func (r *statsRecorder) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,557 @@
+package grpctest_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestLastPeer(t *testing.T) {
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx := context.Background()
+
+	// Nothing is recorded until capture is enabled
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p := server.LastPeer(); p != nil {
+		t.Fatalf("expected nil peer before capture is enabled, got %v", p)
+	}
+
+	server.EnablePeerCapture()
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p := server.LastPeer()
+	if p == nil {
+		t.Fatal("expected peer to be captured")
+	}
+	if p.Addr == nil {
+		t.Error("expected peer address to be set")
+	}
+	if _, ok := p.AuthInfo.(credentials.TLSInfo); !ok {
+		t.Errorf("expected TLS auth info, got %T", p.AuthInfo)
+	}
+}
+
+func TestLastAuthInfo(t *testing.T) {
+	caPool, serverCert, clientCert, err := grpctest.GenerateMTLSPair()
+	if err != nil {
+		t.Fatalf("failed to generate mTLS pair: %v", err)
+	}
+
+	server := grpctest.NewUnstartedServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn(grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      caPool,
+		ServerName:   "localhost",
+	}))))
+	ctx := context.Background()
+
+	// Nothing is recorded until capture is enabled
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info := server.LastAuthInfo(); info != nil {
+		t.Fatalf("expected nil auth info before capture is enabled, got %v", info)
+	}
+
+	server.EnableAuthInfoCapture()
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, ok := server.LastAuthInfo().(credentials.TLSInfo)
+	if !ok {
+		t.Fatalf("expected TLS auth info, got %T", server.LastAuthInfo())
+	}
+	if len(info.State.VerifiedChains) == 0 {
+		t.Fatal("expected a verified client certificate chain")
+	}
+	if leaf := info.State.VerifiedChains[0][0]; !bytes.Equal(leaf.Raw, clientCert.Certificate[0]) {
+		t.Errorf("expected the client certificate, got %q", leaf.Subject)
+	}
+
+	server.Reset()
+	if info := server.LastAuthInfo(); info != nil {
+		t.Errorf("expected nil auth info after reset, got %v", info)
+	}
+}
+
+func TestLastRawRequest(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithRawRequestCapture())
+	defer server.Close()
+
+	if raw := server.LastRawRequest(); raw != nil {
+		t.Fatalf("expected nil raw request before any call, got %x", raw)
+	}
+
+	req := &pb.HelloRequest{Name: "World"}
+	client := pb.NewGreeterClient(server.ClientConn())
+	if _, err := client.SayHello(context.Background(), req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatalf("failed to marshal request: %v", err)
+	}
+	if raw := server.LastRawRequest(); !bytes.Equal(raw, want) {
+		t.Errorf("expected raw request %x, got %x", want, raw)
+	}
+
+	server.Reset()
+	if raw := server.LastRawRequest(); raw != nil {
+		t.Errorf("expected nil raw request after Reset, got %x", raw)
+	}
+}
+
+func TestLastRawRequestDisabled(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if raw := server.LastRawRequest(); raw != nil {
+		t.Errorf("expected nil raw request without WithRawRequestCapture, got %x", raw)
+	}
+}
+
+func TestLastClientHello(t *testing.T) {
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	if hello := server.LastClientHello(); hello != nil {
+		t.Fatalf("expected nil ClientHello before any handshake, got %v", hello)
+	}
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hello := server.LastClientHello()
+	if hello == nil {
+		t.Fatal("expected ClientHello to be recorded")
+	}
+	if hello.ServerName != "localhost" {
+		t.Errorf("expected server name localhost, got %q", hello.ServerName)
+	}
+	if !slices.Contains(hello.SupportedProtos, "h2") {
+		t.Errorf("expected h2 to be offered, got %v", hello.SupportedProtos)
+	}
+
+	// Failed handshakes are recorded too
+	_, err := tls.Dial("tcp", server.URL, &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         "example.com",
+		NextProtos:         []string{"unknown"},
+	})
+	if err == nil {
+		t.Fatal("expected handshake to fail")
+	}
+	if hello := server.LastClientHello(); hello == nil || hello.ServerName != "example.com" {
+		t.Errorf("expected ClientHello of the failed handshake, got %v", hello)
+	}
+
+	server.Reset()
+	if hello := server.LastClientHello(); hello != nil {
+		t.Errorf("expected nil ClientHello after Reset, got %v", hello)
+	}
+}
+
+func TestSetMaxHandlerDuration(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				if req.Name == "slow" {
+					time.Sleep(50 * time.Millisecond)
+				}
+				return &pb.HelloReply{Message: "Hello " + req.Name}, nil
+			},
+		})
+	})
+	defer server.Close()
+
+	recorder := &syncErrorRecorder{TB: t}
+	server.SetMaxHandlerDuration(recorder, 20*time.Millisecond)
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	call := func(name string) {
+		t.Helper()
+		if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: name}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	call("fast")
+	if messages := recorder.Messages(); len(messages) != 0 {
+		t.Fatalf("expected no failure for a fast handler, got %v", messages)
+	}
+
+	call("slow")
+	messages := recorder.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 failure for a slow handler, got %v", messages)
+	}
+	if !strings.Contains(messages[0], "/hello.Greeter/SayHello") {
+		t.Errorf("expected the failure to name the method, got %q", messages[0])
+	}
+
+	// A zero duration removes the watchdog
+	server.SetMaxHandlerDuration(recorder, 0)
+	call("slow")
+	if messages := recorder.Messages(); len(messages) != 1 {
+		t.Errorf("expected no failure once the watchdog is removed, got %v", messages)
+	}
+}
+
+// syncErrorRecorder is a [testing.TB] recording the messages passed to Errorf,
+// which may be called from the server's goroutines.
+type syncErrorRecorder struct {
+	testing.TB
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *syncErrorRecorder) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, fmt.Sprintf(format, args...))
+}
+
+func (r *syncErrorRecorder) Messages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.messages)
+}
+
+func TestStreamStats(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	const method = "/hello.Greeter/SayHelloClientStream"
+	if recv, sent := server.StreamStats(method); recv != 0 || sent != 0 {
+		t.Fatalf("expected no message before any stream, got %d received and %d sent", recv, sent)
+	}
+
+	for _, names := range [][]string{{"Alice"}, {"Alice", "Bob", "Carol"}} {
+		stream, err := server.GreeterClientStream(context.Background())
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		for _, name := range names {
+			if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+		}
+		if _, err := stream.CloseAndRecv(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Only the last stream is reported
+	if recv, sent := server.StreamStats(method); recv != 3 || sent != 1 {
+		t.Errorf("expected 3 messages received and 1 sent, got %d and %d", recv, sent)
+	}
+
+	server.Reset()
+	if recv, sent := server.StreamStats(method); recv != 0 || sent != 0 {
+		t.Errorf("expected no message after reset, got %d received and %d sent", recv, sent)
+	}
+}
+
+func TestActiveStreams(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	// waitForStreams waits until the active streams are the expected ones
+	waitForStreams := func(want ...string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got := server.ActiveStreams()
+			if slices.Equal(got, want) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected active streams %v, got %v", want, got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitForStreams()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bidi, err := client.SayHelloStream(ctx)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	if _, err := client.SayHelloStream(ctx); err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	clientStream, err := server.GreeterClientStream(ctx)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	waitForStreams("/hello.Greeter/SayHelloClientStream", "/hello.Greeter/SayHelloStream", "/hello.Greeter/SayHelloStream")
+
+	// The default handler closes the stream once it has replied
+	if err := bidi.Send(&pb.HelloRequest{Name: "Alice"}); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	if _, err := bidi.Recv(); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if _, err := clientStream.CloseAndRecv(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForStreams("/hello.Greeter/SayHelloStream")
+
+	cancel()
+	waitForStreams()
+}
+
+func TestTotalCalls(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	for range 3 {
+		if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "Alice"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	stream, err := server.GreeterClientStream(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Rejected calls are counted as well
+	server.SetFlakiness(1, codes.Unavailable)
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "Alice"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got := server.TotalCalls(); got != 5 {
+		t.Errorf("expected 5 calls, got %d", got)
+	}
+
+	server.Reset()
+	if got := server.TotalCalls(); got != 0 {
+		t.Errorf("expected no call after reset, got %d", got)
+	}
+}
+
+func TestCallCount(t *testing.T) {
+	var attempts atomic.Int32
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				// The first 2 attempts fail
+				if attempts.Add(1) <= 2 {
+					return nil, status.Error(codes.Unavailable, "try again")
+				}
+				return &pb.HelloReply{Message: "Hello " + req.Name}, nil
+			},
+		})
+	})
+	defer server.Close()
+
+	const method = "/hello.Greeter/SayHello"
+	if got := server.CallCount(method); got != 0 {
+		t.Fatalf("expected no call, got %d", got)
+	}
+
+	conn := server.ClientConn(grpc.WithDefaultServiceConfig(`{
+		"methodConfig": [{
+			"name": [{"service": "hello.Greeter"}],
+			"retryPolicy": {
+				"maxAttempts": 3,
+				"initialBackoff": "0.01s",
+				"maxBackoff": "0.01s",
+				"backoffMultiplier": 1,
+				"retryableStatusCodes": ["UNAVAILABLE"]
+			}
+		}]
+	}`))
+	if _, err := pb.NewGreeterClient(conn).SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := server.CallCount(method); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+	if got := server.CallCount("/hello.Greeter/SayHelloStream"); got != 0 {
+		t.Errorf("expected no call to another method, got %d", got)
+	}
+}
+
+func TestTimings(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				time.Sleep(delay)
+				return &pb.HelloReply{Message: "Hello " + req.Name}, nil
+			},
+		})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	call := func(int) error {
+		_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+		return err
+	}
+
+	// Nothing is recorded until timing is enabled
+	if err := call(0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if timings := server.Timings(); len(timings) != 0 {
+		t.Fatalf("expected no timing before timing is enabled, got %v", timings)
+	}
+
+	server.EnableTiming()
+	for _, err := range grpctest.RunConcurrent(5, call) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	durations := server.Timings()["/hello.Greeter/SayHello"]
+	if len(durations) != 5 {
+		t.Fatalf("expected 5 durations, got %d", len(durations))
+	}
+	for _, d := range durations {
+		if d < delay {
+			t.Errorf("expected duration of at least %v, got %v", delay, d)
+		}
+	}
+
+	server.Reset()
+	if timings := server.Timings(); len(timings) != 0 {
+		t.Errorf("expected no timing after Reset, got %v", timings)
+	}
+}
+
+func TestNegotiatedCipherSuite(t *testing.T) {
+	register := func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}
+	call := func(server *grpctest.Server) {
+		client := pb.NewGreeterClient(server.ClientConn())
+		if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	t.Run("TLS", func(t *testing.T) {
+		server := grpctest.NewUnstartedServer(register)
+		server.TLS = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+		}
+		server.StartTLS()
+		defer server.Close()
+
+		if _, ok := server.NegotiatedCipherSuite(); ok {
+			t.Fatal("expected no cipher suite before any handshake")
+		}
+		call(server)
+		suite, ok := server.NegotiatedCipherSuite()
+		if !ok || suite != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+			t.Errorf("expected %s, got %s (ok: %v)", tls.CipherSuiteName(tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384), tls.CipherSuiteName(suite), ok)
+		}
+	})
+
+	t.Run("plain text", func(t *testing.T) {
+		server := grpctest.NewServer(register)
+		defer server.Close()
+
+		call(server)
+		if _, ok := server.NegotiatedCipherSuite(); ok {
+			t.Error("expected no cipher suite for a plain text server")
+		}
+	})
+}
+
+func TestLastRequestCompression(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	if got := server.LastRequestCompression(); got != "" {
+		t.Fatalf("expected no compression before any request, got %q", got)
+	}
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := server.LastRequestCompression(); got != "" {
+		t.Errorf("expected no compression, got %q", got)
+	}
+
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}, grpc.UseCompressor(gzip.Name)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := server.LastRequestCompression(); got != gzip.Name {
+		t.Errorf("expected %q compression, got %q", gzip.Name, got)
+	}
+
+	server.Reset()
+	if got := server.LastRequestCompression(); got != "" {
+		t.Errorf("expected no compression after reset, got %q", got)
+	}
+}
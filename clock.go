@@ -0,0 +1,27 @@
+package grpctest
+
+import "time"
+
+// clock abstracts the time functions used by the server, so that time-based features
+// can be tested deterministically (see [WithClock]).
+type clock struct {
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// clock returns the clock configured with [WithClock], defaulting to the system clock.
+func (c *ServerConfig) clock() clock {
+	clk := clock{now: c.now, sleep: c.sleep}
+	if clk.now == nil {
+		clk.now = time.Now
+	}
+	if clk.sleep == nil {
+		clk.sleep = time.Sleep
+	}
+	return clk
+}
+
+// since returns the time elapsed since t.
+func (c clock) since(t time.Time) time.Duration {
+	return c.now().Sub(t)
+}
@@ -0,0 +1,35 @@
+package grpctest
+
+import "sync"
+
+// RunConcurrent calls fn n times concurrently, each call in its own goroutine with its
+// iteration index, and waits for all of them to return.
+// The returned slice has n elements: errs[i] is the error returned by fn(i).
+//
+// This keeps stress tests concise while attributing failures to specific iterations.
+//
+// Example:
+//
+//	client := pb.NewGreeterClient(server.ClientConn())
+//	errs := grpctest.RunConcurrent(100, func(i int) error {
+//		_, err := client.SayHello(ctx, &pb.HelloRequest{Name: fmt.Sprint(i)})
+//		return err
+//	})
+//	for i, err := range errs {
+//		if err != nil {
+//			t.Errorf("call %d: %v", i, err)
+//		}
+//	}
+func RunConcurrent(n int, fn func(i int) error) []error {
+	errs := make([]error, max(n, 0))
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
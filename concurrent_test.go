@@ -0,0 +1,58 @@
+package grpctest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRunConcurrent(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				if req.Name == "3" {
+					return nil, status.Error(codes.InvalidArgument, "unlucky")
+				}
+				return &pb.HelloReply{Message: "Hello " + req.Name}, nil
+			},
+		})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	errs := grpctest.RunConcurrent(10, func(i int) error {
+		_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: fmt.Sprint(i)})
+		return err
+	})
+
+	if len(errs) != 10 {
+		t.Fatalf("expected 10 errors, got %d", len(errs))
+	}
+	for i, err := range errs {
+		if i == 3 {
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("call %d: expected InvalidArgument, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("call %d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestRunConcurrentNoIteration(t *testing.T) {
+	errs := grpctest.RunConcurrent(0, func(i int) error {
+		t.Error("unexpected call")
+		return nil
+	})
+	if len(errs) != 0 {
+		t.Errorf("expected no error, got %v", errs)
+	}
+}
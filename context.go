@@ -0,0 +1,77 @@
+package grpctest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// CanceledContext returns a context that is already canceled.
+// It is useful to assert that handlers return codes.Canceled.
+func CanceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+// ExpiredContext returns a context whose deadline is already exceeded.
+// It is useful to assert that handlers return codes.DeadlineExceeded.
+func ExpiredContext() context.Context {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	// The context is already done: canceling releases its resources
+	// without changing the reported error
+	cancel()
+	return ctx
+}
+
+// OutgoingContext returns a copy of ctx with the given key/value pairs appended to its
+// outgoing metadata, as sent by a client.
+// It wraps [metadata.AppendToOutgoingContext] and panics if len(kv) is odd.
+func OutgoingContext(ctx context.Context, kv ...string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// IncomingContext returns a copy of ctx with the given key/value pairs appended to its
+// incoming metadata, as received by a server.
+// It is useful to call handlers directly (without a transport) and panics if len(kv) is odd.
+func IncomingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return metadata.NewIncomingContext(ctx, metadata.Join(md, metadata.Pairs(kv...)))
+}
+
+// maxTestContextMargin is the maximum time left between the deadline of a [TestContext] and the test deadline.
+const maxTestContextMargin = 5 * time.Second
+
+// TestContext returns a context derived from tb.Context, whose deadline is set shortly
+// before the deadline of the test (see [testing.T.Deadline]), leaving a safety margin of a tenth of
+// the remaining time, up to 5 seconds. The context has no deadline if tb does not report one
+// (e.g., when running with -timeout 0). The context is canceled when the test completes.
+//
+// RPCs using this context fail cleanly with an attributable DeadlineExceeded error,
+// instead of the opaque panic of the overall test timeout.
+func TestContext(tb testing.TB) (context.Context, context.CancelFunc) {
+	tb.Helper()
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if deadline, ok := testDeadline(tb); ok {
+		margin := min(time.Until(deadline)/10, maxTestContextMargin)
+		ctx, cancel = context.WithDeadline(tb.Context(), deadline.Add(-margin))
+	} else {
+		ctx, cancel = context.WithCancel(tb.Context())
+	}
+	tb.Cleanup(cancel)
+	return ctx, cancel
+}
+
+// testDeadline returns the deadline of tb, if tb reports one like [testing.T] does.
+func testDeadline(tb testing.TB) (time.Time, bool) {
+	if t, ok := tb.(interface{ Deadline() (time.Time, bool) }); ok {
+		return t.Deadline()
+	}
+	return time.Time{}, false
+}
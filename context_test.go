@@ -0,0 +1,94 @@
+package grpctest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/grpctest"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestCanceledContext(t *testing.T) {
+	ctx := grpctest.CanceledContext()
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", ctx.Err())
+	}
+}
+
+func TestExpiredContext(t *testing.T) {
+	ctx := grpctest.ExpiredContext()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", ctx.Err())
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		t.Error("expected context to have a deadline")
+	}
+}
+
+func TestOutgoingContext(t *testing.T) {
+	ctx := grpctest.OutgoingContext(context.Background(), "authorization", "Bearer token")
+	ctx = grpctest.OutgoingContext(ctx, "x-request-id", "42")
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		t.Fatal("expected outgoing metadata")
+	}
+	if got := md.Get("authorization"); len(got) != 1 || got[0] != "Bearer token" {
+		t.Errorf("expected authorization=Bearer token, got %v", got)
+	}
+	if got := md.Get("x-request-id"); len(got) != 1 || got[0] != "42" {
+		t.Errorf("expected x-request-id=42, got %v", got)
+	}
+}
+
+func TestIncomingContext(t *testing.T) {
+	ctx := grpctest.IncomingContext(context.Background(), "authorization", "Bearer token")
+	ctx = grpctest.IncomingContext(ctx, "x-request-id", "42")
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		t.Fatal("expected incoming metadata")
+	}
+	if got := md.Get("authorization"); len(got) != 1 || got[0] != "Bearer token" {
+		t.Errorf("expected authorization=Bearer token, got %v", got)
+	}
+	if got := md.Get("x-request-id"); len(got) != 1 || got[0] != "42" {
+		t.Errorf("expected x-request-id=42, got %v", got)
+	}
+}
+
+func TestTestContext(t *testing.T) {
+	t.Run("with test deadline", func(t *testing.T) {
+		testDeadline, ok := t.Deadline()
+		if !ok {
+			t.Skip("test run without timeout")
+		}
+		ctx, cancel := grpctest.TestContext(t)
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Fatal("expected context to have a deadline")
+		}
+		if !deadline.Before(testDeadline) {
+			t.Errorf("expected deadline %v to be before the test deadline %v", deadline, testDeadline)
+		}
+		if testDeadline.Sub(deadline) > 5*time.Second {
+			t.Errorf("expected a safety margin of at most 5s, got %v", testDeadline.Sub(deadline))
+		}
+	})
+
+	t.Run("without test deadline", func(t *testing.T) {
+		// errorRecorder does not expose the deadline of the test
+		ctx, cancel := grpctest.TestContext(&errorRecorder{TB: t})
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("expected context without deadline")
+		}
+		cancel()
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", ctx.Err())
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package grpctest
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BeginDrain starts draining the server: new RPCs fail with [codes.Unavailable] while
+// in-flight RPCs are allowed to finish, then the server is closed.
+// It returns a channel closed once the server is closed.
+//
+// This models a graceful rollout, to assert that clients fail over on Unavailable.
+// Note that long-lived streams delay the closing of the server until they end.
+// Calling BeginDrain several times returns the same channel.
+func (s *Server) BeginDrain() <-chan struct{} {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.drained != nil {
+		return s.drained
+	}
+	drained := make(chan struct{})
+	s.drained = drained
+
+	// No RPC is admitted once drained is set, so waiting is safe
+	go func() {
+		s.inFlight.Wait()
+
+		// Let the responses of the last RPCs be sent before closing
+		s.mu.Lock()
+		server := s.server
+		s.mu.Unlock()
+		if server != nil {
+			server.GracefulStop()
+		}
+		s.Close()
+		close(drained)
+	}()
+	return drained
+}
+
+// beginCall counts a new RPC as in flight, unless the server is draining.
+func (s *Server) beginCall() error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.drained != nil {
+		return status.Error(codes.Unavailable, "grpctest: server is draining")
+	}
+	s.inFlight.Add(1)
+	return nil
+}
@@ -0,0 +1,74 @@
+package grpctest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// blockingGreeter blocks SayHello until release is closed.
+type blockingGreeter struct {
+	pb.UnimplementedGreeterServer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (g *blockingGreeter) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+	g.entered <- struct{}{}
+	<-g.release
+	return &pb.HelloReply{Message: "Hello " + req.GetName()}, nil
+}
+
+func TestBeginDrain(t *testing.T) {
+	greeter := &blockingGreeter{entered: make(chan struct{}, 1), release: make(chan struct{})}
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, greeter)
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+
+	// Start an RPC which is in flight when draining begins
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+		errCh <- err
+	}()
+	<-greeter.entered
+
+	drained := server.BeginDrain()
+	if again := server.BeginDrain(); again != drained {
+		t.Error("expected BeginDrain to return the same channel when called twice")
+	}
+
+	// New RPCs are rejected
+	_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable while draining, got %v", err)
+	}
+	select {
+	case <-drained:
+		t.Fatal("expected server to wait for the in-flight RPC")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The in-flight RPC completes, then the server is closed
+	close(greeter.release)
+	if err := <-errCh; err != nil {
+		t.Errorf("expected in-flight RPC to succeed, got %v", err)
+	}
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the server to be closed")
+	}
+	if !server.Closed() {
+		t.Error("expected server to be closed after draining")
+	}
+}
@@ -0,0 +1,92 @@
+package grpctest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DynamicInvoke calls the unary method fullMethod (e.g., "/hello.Greeter/SayHello") with the
+// request given in the protobuf JSON format, and returns the response in the same format.
+//
+// The request and response messages are built dynamically from the method descriptor, found
+// with protobuf reflection among the descriptors linked in the test binary, so no compiled
+// stub is needed on the client side. This lets schema-agnostic tooling (e.g., generic API test
+// harnesses) exercise any method registered on the server.
+//
+// The response is compact JSON, thus stable across runs. RPC errors are returned as is,
+// so their status can be inspected with [status.FromError].
+// Streaming methods are not supported.
+func (s *Server) DynamicInvoke(ctx context.Context, fullMethod string, reqJSON string) (string, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "", fmt.Errorf("grpctest: invalid full method %q", fullMethod)
+	}
+
+	s.mu.Lock()
+	if !s.started || s.closed {
+		s.mu.Unlock()
+		return "", errors.New("grpctest: server not serving")
+	}
+	info, registered := s.server.GetServiceInfo()[service]
+	conn := s.defaultClient()
+	s.mu.Unlock()
+
+	if !registered {
+		return "", fmt.Errorf("grpctest: service %q not registered", service)
+	}
+	md, err := findMethod(service, method)
+	if err != nil {
+		return "", err
+	}
+	for _, m := range info.Methods {
+		if m.Name == method && (m.IsClientStream || m.IsServerStream) {
+			return "", fmt.Errorf("grpctest: streaming method %q not supported", fullMethod)
+		}
+	}
+
+	req := dynamicpb.NewMessage(md.Input())
+	if err := protojson.Unmarshal([]byte(reqJSON), req); err != nil {
+		return "", fmt.Errorf("grpctest: invalid request for %q: %w", fullMethod, err)
+	}
+	resp := dynamicpb.NewMessage(md.Output())
+	if err := conn.Invoke(ctx, fullMethod, req, resp); err != nil {
+		return "", err
+	}
+
+	b, err := protojson.Marshal(resp)
+	if err != nil {
+		return "", fmt.Errorf("grpctest: failed to marshal response of %q: %w", fullMethod, err)
+	}
+	// protojson randomizes whitespaces on purpose
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, b); err != nil {
+		return "", fmt.Errorf("grpctest: failed to marshal response of %q: %w", fullMethod, err)
+	}
+	return compact.String(), nil
+}
+
+// findMethod returns the descriptor of the given method of service from the global registry.
+func findMethod(service, method string) (protoreflect.MethodDescriptor, error) {
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("grpctest: descriptor of service %q not found: %w", service, err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("grpctest: %q is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("grpctest: method %q not found in service %q", method, service)
+	}
+	return md, nil
+}
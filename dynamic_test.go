@@ -0,0 +1,52 @@
+package grpctest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDynamicInvoke(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	ctx := context.Background()
+	got, err := server.DynamicInvoke(ctx, "/hello.Greeter/SayHello", `{"name": "Alice"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `{"message":"Hello Alice"}`; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	server.InjectErrorWithDetails("/hello.Greeter/SayHello", status.New(codes.NotFound, "no such greeting"))
+	if _, err := server.DynamicInvoke(ctx, "/hello.Greeter/SayHello", `{}`); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+	server.InjectErrorWithDetails("/hello.Greeter/SayHello", nil)
+
+	for name, tc := range map[string]struct {
+		fullMethod string
+		reqJSON    string
+	}{
+		"invalid method":      {fullMethod: "SayHello", reqJSON: `{}`},
+		"unknown service":     {fullMethod: "/hello.Unknown/SayHello", reqJSON: `{}`},
+		"unknown method":      {fullMethod: "/hello.Greeter/SayGoodbye", reqJSON: `{}`},
+		"streaming method":    {fullMethod: "/hello.Greeter/SayHelloStream", reqJSON: `{}`},
+		"invalid request":     {fullMethod: "/hello.Greeter/SayHello", reqJSON: `{"unknown": 1}`},
+		"request not in JSON": {fullMethod: "/hello.Greeter/SayHello", reqJSON: `name: "Alice"`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := server.DynamicInvoke(ctx, tc.fullMethod, tc.reqJSON); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
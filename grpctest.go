@@ -2,22 +2,43 @@
 package grpctest
 
 import (
+	"cmp"
+	"context"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"testing"
 	"time"
 
+	pb "github.com/loicsikidi/grpctest/proto/hello"
 	"google.golang.org/grpc"
+	channelzsvc "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
 )
 
 // Server represents a gRPC test server, similar to [httptest.Server].
@@ -30,24 +51,84 @@ type Server struct {
 	// For servers created with NewTLSServer, this will be populated with
 	// a self-signed certificate. For clients to trust the server,
 	// use the [Server.Certificate] method to get the server's certificate.
+	//
+	// It can be set before calling StartTLS to serve a custom configuration
+	// (e.g., cipher suites, client authentication). If it provides a certificate
+	// (Certificates, GetCertificate or GetConfigForClient), it is used as-is;
+	// otherwise a self-signed certificate is generated and added to it.
+	// The preset configuration is never modified: it is cloned when the server starts,
+	// so that it can be shared between servers.
 	TLS *tls.Config
 
 	// Listener is the network listener the server is using.
 	// It will be set after Start or StartTLS is called.
 	Listener net.Listener
 
+	// AdminURL is the address of the admin server (e.g., "127.0.0.1:12346").
+	// It is only set when admin services are configured with [WithAdminServices].
+	AdminURL string
+
 	// Config holds optional gRPC server options.
 	// You can modify [ServerConfig] before calling Start() or StartTLS()
 	// to add interceptors or other gRPC options.
 	Config *ServerConfig
 
-	mu      sync.Mutex
-	server  *grpc.Server
-	started bool
-	closed  bool
-	client  *grpc.ClientConn
-	useTLS  bool
-	cert    *x509.Certificate
+	mu            sync.Mutex
+	server        *grpc.Server
+	started       bool
+	closed        bool
+	client        *grpc.ClientConn   // cached client connection
+	conns         []*grpc.ClientConn // all client connections created by the server
+	useTLS        bool
+	cert          *x509.Certificate
+	done          chan struct{}                   // closed when the server is closed
+	tlsCert       atomic.Pointer[tls.Certificate] // served certificate (replaced on rotation)
+	generatedCert bool                            // whether the certificate was generated by the server
+	adminServer   *grpc.Server
+	serveErrCh    <-chan error // receives the serve error once serving ends
+	serveErr      error
+	bufListener   *bufconn.Listener // set when serving in memory
+	listener      *serverListener   // wraps the listener set as Listener
+	acceptedConns atomic.Int64      // connections accepted by Listener
+
+	// stateMu guards the state shared with the serving goroutines (e.g. interceptors).
+	// It is distinct from mu since Close holds mu while waiting for the server to stop.
+	stateMu       sync.Mutex
+	capturePeer   bool
+	lastPeer      *peer.Peer
+	captureAuth   bool
+	lastAuthInfo  credentials.AuthInfo
+	recording     bool
+	recorded      *recorder // calls recorded while recording
+	captureTiming bool
+	timings       map[string][]time.Duration // handler durations per full method
+	watchdog      *handlerWatchdog           // fails the test on slow handlers
+	streamStats   map[string]*streamStats    // message counts of the last stream per full method
+	calls         map[string]int             // number of RPCs received per full method
+	activeStreams map[string]int             // number of open streams per full method (not cleared by Reset)
+	pauseGate     chan struct{}              // non-nil while paused, closed on resume
+	headers       map[string]metadata.MD     // response headers per full method
+	trailers      map[string]metadata.MD     // response trailers per full method
+	rateLimits    map[string]*rateLimiter    // token buckets per full method
+	transformer   func(string, any) any      // transforms unary responses
+	responses     map[string]proto.Message   // canned unary responses per full method
+	blackholes    map[string]bool            // full methods which never respond
+	requiredMD    map[string]codes.Code      // required metadata keys and their rejection code
+	injectedErrs  map[string]error           // errors returned per full method
+	streamErrs    map[string]streamError     // errors injected on streams per full method
+	maxReqSizes   map[string]int             // maximum request message sizes per full method
+	flakiness     *flakiness                 // random failures of RPCs
+	jitter        *jitter                    // random delays of RPCs
+	latency       time.Duration              // fixed delay of RPCs, ignoring cancellation
+	lastRawReq    []byte                     // raw bytes of the last request message
+	lastCompress  string                     // compression algorithm of the last request
+	lastHello     *tls.ClientHelloInfo       // ClientHello of the last TLS handshake
+	cipherSuite   uint16                     // cipher suite of the last completed TLS handshake
+	handshaked    bool                       // whether a TLS handshake has completed
+	resumed       bool                       // whether the last completed TLS handshake resumed a session
+	expectedSNI   *string                    // server name required in TLS handshakes
+	drained       chan struct{}              // non-nil while draining, closed once the server is closed
+	inFlight      sync.WaitGroup             // RPCs admitted by the server's interceptors
 }
 
 // ServerConfig holds configuration for a test server.
@@ -56,9 +137,264 @@ type ServerConfig struct {
 	// This is set during server creation and should not be modified.
 	registerService func(*grpc.Server)
 
+	// registerWithSelf is like registerService, but also receives the test server.
+	// This is set by [NewServerWithSelf] and should not be modified.
+	registerWithSelf func(*grpc.Server, *Server)
+
 	// ServerOptions are optional gRPC server options.
 	// These can be modified before calling Start() or StartTLS().
 	ServerOptions []grpc.ServerOption
+
+	// greeter is the [pb.GreeterServer] registered by [WithGreeter], also used by [Server.DirectClient].
+	greeter pb.GreeterServer
+
+	// serverFactory creates the gRPC server (nil means [grpc.NewServer]).
+	serverFactory func(opts ...grpc.ServerOption) *grpc.Server
+
+	// tlsOptions lists the options set which are only valid for TLS servers.
+	tlsOptions []string
+
+	// certRand is the source of randomness used to generate the self-signed certificate.
+	// Defaults to [rand.Reader] when nil.
+	certRand io.Reader
+
+	// certClock returns the time used as the start of the certificate validity period.
+	// Defaults to the clock set by [WithClock] when nil.
+	certClock func() time.Time
+
+	// certSubject overrides the subject of the self-signed certificate (nil means the default subject).
+	certSubject *pkix.Name
+
+	// now and sleep are the time functions used by the server (see [WithClock]).
+	// They default to [time.Now] and [time.Sleep] when nil.
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	// channelz reports whether the channelz service is registered on the server.
+	channelz bool
+
+	// reflection reports whether the reflection service is registered on the server.
+	reflection bool
+
+	// adminServices registers the services served by the admin server.
+	adminServices func(*grpc.Server)
+
+	// bufconn reports whether the server listens in memory instead of on a TCP port.
+	bufconn bool
+
+	// quiet disables the logging of the serve error.
+	quiet bool
+
+	// maxRecvMsgSize is the maximum message size the server can receive (0 means gRPC's default).
+	maxRecvMsgSize int
+
+	// initialWindowSize and initialConnWindowSize are the HTTP/2 flow-control window sizes
+	// applied to both the server and the client (0 means gRPC's default).
+	initialWindowSize     int32
+	initialConnWindowSize int32
+
+	// writeBufferSize and readBufferSize are the sizes of the transport buffers
+	// applied to both the server and the client (nil means gRPC's default).
+	writeBufferSize *int
+	readBufferSize  *int
+
+	// maxHeaderListSize is the maximum size of the header list the server accepts (nil means gRPC's default).
+	maxHeaderListSize *uint32
+
+	// connectionTimeout is the timeout for the setup of new connections, including the TLS handshake
+	// (0 means gRPC's default).
+	connectionTimeout time.Duration
+
+	// maxConnectionIdle is the duration after which the server closes idle connections
+	// with a GOAWAY (0 means gRPC's default, i.e. infinity).
+	maxConnectionIdle time.Duration
+
+	// errorMapper converts the non-status errors returned by handlers (nil means no conversion).
+	errorMapper func(error) error
+
+	// recorderCapacity is the number of calls kept by the recorder (0 means unbounded).
+	recorderCapacity int
+
+	// randSeed is the seed of the random failures and delays set by [Server.SetFlakiness]
+	// and [Server.InjectJitter] (nil means a random seed).
+	randSeed *int64
+
+	// streamShuffle is the seed used to reorder the messages sent on streams (nil means no reordering).
+	streamShuffle *int64
+
+	// closeTimeout is the time given to in-flight RPCs to complete when the server is closed
+	// (0 means the server is stopped immediately).
+	closeTimeout time.Duration
+
+	// numStreamWorkers is the number of workers of the shared pool handling streams (0 means no pool).
+	numStreamWorkers uint32
+
+	// clientInsecureSkipVerify disables the verification of the server's certificate by the client.
+	clientInsecureSkipVerify bool
+
+	// clientServerName is the server name (SNI) sent by the client ("" means "localhost").
+	clientServerName string
+
+	// clientCipherSuites are the TLS 1.2 cipher suites offered by the client (nil means Go's default).
+	clientCipherSuites []uint16
+
+	// strictTLS reports whether the served certificate must use an approved key type
+	// and be currently valid.
+	strictTLS bool
+
+	// sessionTicketsDisabled disables TLS session resumption with session tickets.
+	sessionTicketsDisabled bool
+
+	// alpn lists the application protocols advertised by the server during the TLS handshake
+	// (nil means gRPC's default, i.e. "h2").
+	alpn []string
+
+	// metadataEcho reports whether the request metadata is echoed in the response trailers.
+	metadataEcho bool
+
+	// rawRequestCapture reports whether the raw bytes of incoming requests are recorded.
+	rawRequestCapture bool
+
+	// unknownMethodCode is the status code returned for unknown methods (nil means Unimplemented).
+	unknownMethodCode *codes.Code
+
+	// preServe are the hooks called once the listener is bound, before serving.
+	preServe []func(net.Addr)
+
+	// postClose are the hooks called at the end of Close.
+	postClose []func()
+
+	// rawConnInspector wraps the connections accepted by the server, before the gRPC transport.
+	rawConnInspector func(net.Conn) net.Conn
+
+	// connStateHook is notified when the server accepts and closes connections.
+	connStateHook func(addr net.Addr, state string)
+
+	// connectParams configures the connection backoff of the client (nil means gRPC's default).
+	connectParams *grpc.ConnectParams
+
+	// clientServiceConfig is the default service config of the client, in JSON ("" means none).
+	clientServiceConfig string
+
+	// unaryInterceptors and streamInterceptors are installed by options
+	// and chained after the interceptors set in ServerOptions.
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+
+	// tlsUnaryInterceptors are chained after unaryInterceptors, only when the server uses TLS.
+	tlsUnaryInterceptors []grpc.UnaryServerInterceptor
+}
+
+// minWindowSize is the lowest HTTP/2 window size accepted by gRPC.
+const minWindowSize = 64 * 1024
+
+// Validate reports invalid options and incompatible combinations of options.
+// It is called by [Server.Start] and [Server.StartTLS], which additionally reject
+// TLS-only options (e.g., [WithCertRand]) on a plain text server.
+func (c *ServerConfig) Validate() error {
+	var errs []error
+	if c.maxRecvMsgSize < 0 {
+		errs = append(errs, fmt.Errorf("max receive message size must be positive, got %d", c.maxRecvMsgSize))
+	}
+	if c.initialWindowSize != 0 && c.initialWindowSize < minWindowSize {
+		errs = append(errs, fmt.Errorf("initial window size must be at least %d, got %d", minWindowSize, c.initialWindowSize))
+	}
+	if c.initialConnWindowSize != 0 && c.initialConnWindowSize < minWindowSize {
+		errs = append(errs, fmt.Errorf("initial connection window size must be at least %d, got %d", minWindowSize, c.initialConnWindowSize))
+	}
+	if c.unknownMethodCode != nil && *c.unknownMethodCode == codes.OK {
+		errs = append(errs, errors.New("unknown method code must not be OK"))
+	}
+	if c.connectionTimeout < 0 {
+		errs = append(errs, fmt.Errorf("connection timeout must be positive, got %v", c.connectionTimeout))
+	}
+	if c.closeTimeout < 0 {
+		errs = append(errs, fmt.Errorf("close timeout must be positive, got %v", c.closeTimeout))
+	}
+	if c.maxConnectionIdle < 0 {
+		errs = append(errs, fmt.Errorf("max connection idle must be positive, got %v", c.maxConnectionIdle))
+	}
+	if c.clientServiceConfig != "" && !json.Valid([]byte(c.clientServiceConfig)) {
+		errs = append(errs, errors.New("client service config must be valid JSON"))
+	}
+	if c.recorderCapacity < 0 {
+		errs = append(errs, fmt.Errorf("recorder capacity must be positive, got %d", c.recorderCapacity))
+	}
+	return errors.Join(errs...)
+}
+
+// clone returns a deep copy of the configuration.
+func (c *ServerConfig) clone() *ServerConfig {
+	cp := *c
+	cp.ServerOptions = slices.Clone(c.ServerOptions)
+	cp.tlsOptions = slices.Clone(c.tlsOptions)
+	cp.alpn = slices.Clone(c.alpn)
+	cp.clientCipherSuites = slices.Clone(c.clientCipherSuites)
+	cp.unaryInterceptors = slices.Clone(c.unaryInterceptors)
+	cp.streamInterceptors = slices.Clone(c.streamInterceptors)
+	cp.tlsUnaryInterceptors = slices.Clone(c.tlsUnaryInterceptors)
+	cp.preServe = slices.Clone(c.preServe)
+	cp.postClose = slices.Clone(c.postClose)
+	cp.certSubject = clonePtr(c.certSubject)
+	cp.writeBufferSize = clonePtr(c.writeBufferSize)
+	cp.readBufferSize = clonePtr(c.readBufferSize)
+	cp.maxHeaderListSize = clonePtr(c.maxHeaderListSize)
+	cp.connectParams = clonePtr(c.connectParams)
+	cp.streamShuffle = clonePtr(c.streamShuffle)
+	cp.randSeed = clonePtr(c.randSeed)
+	cp.unknownMethodCode = clonePtr(c.unknownMethodCode)
+	return &cp
+}
+
+// clonePtr returns a pointer to a copy of *p, or nil if p is nil.
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// validate validates the configuration for a server started with or without TLS.
+func (c *ServerConfig) validate(useTLS bool) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if !useTLS && len(c.tlsOptions) > 0 {
+		return fmt.Errorf("%s require TLS", strings.Join(c.tlsOptions, ", "))
+	}
+	return nil
+}
+
+// requireTLS records that the named option is only valid for TLS servers.
+func (c *ServerConfig) requireTLS(option string) {
+	if !slices.Contains(c.tlsOptions, option) {
+		c.tlsOptions = append(c.tlsOptions, option)
+	}
+}
+
+// dialOptions returns the client dial options matching the server configuration.
+func (c *ServerConfig) dialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if c.initialWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(c.initialWindowSize))
+	}
+	if c.initialConnWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(c.initialConnWindowSize))
+	}
+	if c.writeBufferSize != nil {
+		opts = append(opts, grpc.WithWriteBufferSize(*c.writeBufferSize))
+	}
+	if c.readBufferSize != nil {
+		opts = append(opts, grpc.WithReadBufferSize(*c.readBufferSize))
+	}
+	if c.connectParams != nil {
+		opts = append(opts, grpc.WithConnectParams(*c.connectParams))
+	}
+	if c.clientServiceConfig != "" {
+		opts = append(opts, grpc.WithDefaultServiceConfig(c.clientServiceConfig))
+	}
+	return opts
 }
 
 // NewServer creates and starts a new gRPC test server listening on a random local port.
@@ -72,14 +408,82 @@ type ServerConfig struct {
 //	defer server.Close()
 //
 //	// server.URL contains the address like "localhost:12345"
-func NewServer(registerFunc func(*grpc.Server)) *Server {
-	s := NewUnstartedServer(registerFunc)
+func NewServer(registerFunc func(*grpc.Server), opts ...Option) *Server {
+	s := NewUnstartedServer(registerFunc, opts...)
+	s.Start()
+	return s
+}
+
+// NewServerWithSelf is like [NewServer], but the registration function also receives the test server,
+// so that service implementations can keep a reference to it. This enables chaos handlers acting
+// on the server from inside an RPC (e.g., draining the server on a specific request).
+//
+// Note: the test server must only be used by the handlers, not within the registration function
+// itself, since the server is being started when it is called.
+//
+// Example:
+//
+//	server := grpctest.NewServerWithSelf(func(s *grpc.Server, ts *grpctest.Server) {
+//		proto.RegisterGreeterServer(s, &grpctest.GreeterServer{
+//			SayHelloHandler: func(ctx context.Context, req *proto.HelloRequest) (*proto.HelloReply, error) {
+//				if req.Name == "shutdown" {
+//					ts.BeginDrain()
+//				}
+//				return &proto.HelloReply{Message: "Hello " + req.Name}, nil
+//			},
+//		})
+//	})
+//	defer server.Close()
+func NewServerWithSelf(registerFunc func(s *grpc.Server, ts *Server), opts ...Option) *Server {
+	s := NewUnstartedServer(nil, opts...)
+	s.Config.registerWithSelf = registerFunc
 	s.Start()
 	return s
 }
 
+// bufconnSize is the buffer size of in-memory listeners.
+const bufconnSize = 1024 * 1024
+
+// NewBenchServer creates and starts a gRPC test server designed for benchmarks.
+// To remove syscall and I/O noise from measurements, the server listens in memory
+// (see [WithBufconn]) and doesn't log its serve error. The cached client connection
+// (see [Server.ClientConn]) is established before returning, and the server is
+// closed when the benchmark completes.
+//
+// Example:
+//
+//	func BenchmarkSayHello(b *testing.B) {
+//		server := grpctest.NewBenchServer(b, func(s *grpc.Server) {
+//			proto.RegisterGreeterServer(s, &myGreeterImpl{})
+//		})
+//		client := proto.NewGreeterClient(server.ClientConn())
+//
+//		for b.Loop() {
+//			client.SayHello(context.Background(), &proto.HelloRequest{Name: "bench"})
+//		}
+//	}
+func NewBenchServer(b *testing.B, registerFunc func(*grpc.Server), opts ...Option) *Server {
+	b.Helper()
+
+	s := NewUnstartedServer(registerFunc, append([]Option{WithBufconn()}, opts...)...)
+	s.Config.quiet = true
+	s.Start()
+	b.Cleanup(s.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.mu.Lock()
+	conn := s.defaultClient()
+	s.mu.Unlock()
+	if err := waitForReady(ctx, conn); err != nil {
+		b.Fatalf("grpctest: failed to warm client connection: %v", err)
+	}
+	return s
+}
+
 // NewUnstartedServer creates a new gRPC test server but does not start it.
 // The caller must call [Server.Start] or [Server.StartTLS] to start the server.
+// The given options are applied to [Server.Config].
 //
 // Example:
 //
@@ -89,14 +493,52 @@ func NewServer(registerFunc func(*grpc.Server)) *Server {
 //	// Configure server as needed
 //	server.Start()
 //	defer server.Close()
-func NewUnstartedServer(registerFunc func(*grpc.Server)) *Server {
+func NewUnstartedServer(registerFunc func(*grpc.Server), opts ...Option) *Server {
+	cfg := &ServerConfig{
+		registerService: registerFunc,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
 	return &Server{
-		Config: &ServerConfig{
-			registerService: registerFunc,
-		},
+		Config: cfg,
+		done:   make(chan struct{}),
 	}
 }
 
+// Clone returns a new unstarted server with a deep copy of the configuration of s,
+// including the registration function, the options and the preset [Server.TLS].
+// This allows creating several variants from a base template in table-driven tests,
+// by modifying the Config of each clone.
+//
+// It panics if s has been started.
+//
+// Example:
+//
+//	base := grpctest.NewUnstartedServer(registerFunc, grpctest.WithReflection())
+//	for _, tc := range tests {
+//		server := base.Clone()
+//		server.Config.ServerOptions = append(server.Config.ServerOptions, tc.opts...)
+//		server.Start()
+//		defer server.Close()
+//	}
+func (s *Server) Clone() *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		panic("grpctest: cannot clone a started server")
+	}
+	clone := &Server{
+		Config: s.Config.clone(),
+		done:   make(chan struct{}),
+	}
+	if s.TLS != nil {
+		clone.TLS = s.TLS.Clone()
+	}
+	return clone
+}
+
 // NewTLSServer creates and starts a new gRPC test server with TLS enabled.
 // The server generates a self-signed certificate.
 // Clients can use the [Server.Certificate] method to get the certificate for trust configuration.
@@ -107,8 +549,8 @@ func NewUnstartedServer(registerFunc func(*grpc.Server)) *Server {
 //		proto.RegisterGreeterServer(s, &myGreeterImpl{})
 //	})
 //	defer server.Close()
-func NewTLSServer(registerFunc func(*grpc.Server)) *Server {
-	s := NewUnstartedServer(registerFunc)
+func NewTLSServer(registerFunc func(*grpc.Server), opts ...Option) *Server {
+	s := NewUnstartedServer(registerFunc, opts...)
 	s.StartTLS()
 	return s
 }
@@ -116,25 +558,84 @@ func NewTLSServer(registerFunc func(*grpc.Server)) *Server {
 // Start starts the server listening on a random local port in plain text mode.
 // If the server is already started, this method does nothing.
 //
-// Note: this method panics if the server fails to start.
+// Note: this method panics if the configuration is invalid (see [ServerConfig.Validate]),
+// if the server is closed or if it fails to start.
 func (s *Server) Start() {
+	if err := s.startPlainText(); err != nil {
+		panic(err.Error())
+	}
+}
+
+// StartWithTimeout is like [Server.Start], but returns ctx.Err() if the server is not bound and
+// serving (see [Server.Ping]) before ctx is done, and returns an error instead of panicking.
+// This gives a deterministic failure instead of a hang when the machine is overloaded (e.g., on CI).
+// If ctx is done before the server is started, the server is closed once started.
+//
+// Example:
+//
+//	server := grpctest.NewUnstartedServer(registerFunc)
+//	defer server.Close()
+//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//	defer cancel()
+//	if err := server.StartWithTimeout(ctx); err != nil {
+//		t.Fatal(err)
+//	}
+func (s *Server) StartWithTimeout(ctx context.Context) error {
+	started := make(chan error, 1)
+	go func() {
+		started <- s.startPlainText()
+	}()
+
+	select {
+	case err := <-started:
+		if err != nil {
+			return err
+		}
+	case <-ctx.Done():
+		go func() {
+			if err := <-started; err == nil {
+				s.Close()
+			}
+		}()
+		return ctx.Err()
+	}
+
+	if err := s.Ping(ctx); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	return nil
+}
+
+// startPlainText starts the server in plain text mode, unless it is already started.
+func (s *Server) startPlainText() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.started {
-		return
+		return nil
+	}
+	if s.closed {
+		return errors.New("grpctest: server closed")
 	}
 
+	if err := s.Config.validate(false); err != nil {
+		return fmt.Errorf("grpctest: invalid configuration: %w", err)
+	}
 	s.useTLS = false
 	if err := s.start(); err != nil {
-		panic(fmt.Sprintf("grpctest: failed to start server: %v", err))
+		return fmt.Errorf("grpctest: failed to start server: %w", err)
 	}
+	return nil
 }
 
 // StartTLS starts the server with TLS enabled using a self-signed certificate.
 // If the server is already started, this method does nothing.
 //
-// Note: this method panics if the server fails to start.
+// Note: this method panics if the configuration is invalid (see [ServerConfig.Validate]),
+// if the server is closed or if it fails to start.
 func (s *Server) StartTLS() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -142,11 +643,22 @@ func (s *Server) StartTLS() {
 	if s.started {
 		return
 	}
+	if s.closed {
+		panic("grpctest: server closed")
+	}
 
+	if err := s.Config.validate(true); err != nil {
+		panic(fmt.Sprintf("grpctest: invalid configuration: %v", err))
+	}
 	s.useTLS = true
 	if err := s.setupTLS(); err != nil {
 		panic(fmt.Sprintf("grpctest: failed to setup TLS: %v", err))
 	}
+	if s.Config.strictTLS {
+		if err := checkStrictCertificate(s.cert, s.Config.clock().now()); err != nil {
+			panic(fmt.Sprintf("grpctest: invalid configuration: %v", err))
+		}
+	}
 	if err := s.start(); err != nil {
 		panic(fmt.Sprintf("grpctest: failed to start server: %v", err))
 	}
@@ -160,65 +672,333 @@ func (s *Server) start() error {
 		return nil
 	}
 
-	// Create listener on random port
-	listener, err := net.Listen("tcp", "127.0.0.1:0")
-	if err != nil {
-		return fmt.Errorf("failed to create listener: %w", err)
+	// Create listener on random port (or in memory)
+	var listener net.Listener
+	if s.Config.bufconn {
+		s.bufListener = bufconn.Listen(bufconnSize)
+		listener = s.bufListener
+	} else {
+		var err error
+		if listener, err = newLocalListener(); err != nil {
+			return err
+		}
+	}
+	s.listener = &serverListener{
+		Listener:  listener,
+		accepted:  &s.acceptedConns,
+		inspect:   s.Config.rawConnInspector,
+		stateHook: s.Config.connStateHook,
 	}
-	s.Listener = listener
+	s.Listener = s.listener
 	s.URL = listener.Addr().String()
 
 	// Prepare server options
-	opts := s.Config.ServerOptions
+	// (cloned so that appending never mutates the user's slice)
+	opts := slices.Clone(s.Config.ServerOptions)
 	if s.useTLS && s.TLS != nil {
 		creds := credentials.NewTLS(s.TLS)
 		opts = append(opts, grpc.Creds(creds))
 	}
+	if s.Config.maxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(s.Config.maxRecvMsgSize))
+	}
+	if s.Config.initialWindowSize > 0 {
+		opts = append(opts, grpc.InitialWindowSize(s.Config.initialWindowSize))
+	}
+	if s.Config.initialConnWindowSize > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(s.Config.initialConnWindowSize))
+	}
+	if s.Config.writeBufferSize != nil {
+		opts = append(opts, grpc.WriteBufferSize(*s.Config.writeBufferSize))
+	}
+	if s.Config.readBufferSize != nil {
+		opts = append(opts, grpc.ReadBufferSize(*s.Config.readBufferSize))
+	}
+	if s.Config.maxHeaderListSize != nil {
+		opts = append(opts, grpc.MaxHeaderListSize(*s.Config.maxHeaderListSize))
+	}
+	if s.Config.connectionTimeout > 0 {
+		opts = append(opts, grpc.ConnectionTimeout(s.Config.connectionTimeout))
+	}
+	if s.Config.maxConnectionIdle > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionIdle: s.Config.maxConnectionIdle}))
+	}
+	if s.Config.numStreamWorkers > 0 {
+		opts = append(opts, grpc.NumStreamWorkers(s.Config.numStreamWorkers))
+	}
+	if s.Config.unknownMethodCode != nil {
+		opts = append(opts, grpc.UnknownServiceHandler(unknownMethodHandler(*s.Config.unknownMethodCode)))
+	}
+	if s.Config.rawRequestCapture {
+		opts = append(opts, grpc.ForceServerCodecV2(s.capturingCodec()))
+	}
+	// Option interceptors run first, then the server's own interceptors
+	unaryInterceptors := slices.Clone(s.Config.unaryInterceptors)
+	if s.useTLS {
+		unaryInterceptors = append(unaryInterceptors, s.Config.tlsUnaryInterceptors...)
+	}
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(append(unaryInterceptors, s.unaryInterceptor)...),
+		grpc.ChainStreamInterceptor(append(slices.Clone(s.Config.streamInterceptors), s.streamInterceptor)...),
+		grpc.StatsHandler(&statsRecorder{server: s}),
+	)
 
 	// Create gRPC server
-	s.server = grpc.NewServer(opts...)
+	newServer := grpc.NewServer
+	if s.Config.serverFactory != nil {
+		newServer = s.Config.serverFactory
+	}
+	s.server = newServer(opts...)
 
 	// Register services
 	if s.Config.registerService != nil {
 		s.Config.registerService(s.server)
 	}
+	if s.Config.registerWithSelf != nil {
+		s.Config.registerWithSelf(s.server, s)
+	}
+	if s.Config.greeter != nil {
+		pb.RegisterGreeterServer(s.server, s.Config.greeter)
+	}
+	if s.Config.channelz {
+		channelzsvc.RegisterChannelzServiceToServer(s.server)
+	}
+	if s.Config.reflection {
+		reflection.Register(s.server)
+	}
+
+	// Run hooks once the listener is bound, before serving
+	for _, hook := range s.Config.preServe {
+		hook(s.Listener.Addr())
+	}
 
 	// Start serving in background
+	s.serveErrCh = serve(s.server, s.Listener, !s.Config.quiet)
+
+	if s.Config.adminServices != nil {
+		if err := s.startAdmin(); err != nil {
+			return err
+		}
+	}
+
+	s.started = true
+	return nil
+}
+
+// newLocalListener creates a TCP listener on a random local port.
+func newLocalListener() (net.Listener, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create listener: %w", err)
+	}
+	return listener, nil
+}
+
+// FreePort returns a free TCP port on the local host (127.0.0.1), for other parts of the
+// test setup (e.g., a sidecar) which need to listen on a local port.
+// The port is released before returning: another process may bind it in the meantime,
+// so it should be used right away.
+func FreePort() (int, error) {
+	listener, err := newLocalListener()
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close() // nolint:errcheck
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// serve starts serving the listener in background, printing the serve error if logErrors is set.
+// The server and listener are passed explicitly since Close resets the fields of [Server].
+// The returned channel receives the serve error once serving ends (nil on normal shutdown).
+func serve(server *grpc.Server, lis net.Listener, logErrors bool) <-chan error {
+	errCh := make(chan error, 1)
 	go func() {
-		if err := s.server.Serve(s.Listener); err != nil {
+		err := server.Serve(lis)
+		if errors.Is(err, grpc.ErrServerStopped) {
+			// The server was closed before serving
+			err = nil
+		}
+		if err != nil && logErrors {
 			fmt.Printf("grpctest: server error: %v\n", err)
 		}
+		errCh <- err
 	}()
+	return errCh
+}
 
-	s.started = true
-	return nil
+// ServeError returns the error which made the server stop serving unexpectedly
+// (e.g., a listener failure), or nil if the server is serving or was closed normally.
+// Such errors are otherwise only printed, see [Server.FailOnServeError] to fail the test instead.
+func (s *Server) ServeError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.serveErrCh != nil {
+		select {
+		case s.serveErr = <-s.serveErrCh:
+			s.serveErrCh = nil
+		default:
+		}
+	}
+	return s.serveErr
 }
 
-// setupTLS generates a self-signed certificate for the test server.
+// FailOnServeError registers a cleanup function with tb which fails the test if the server
+// stopped serving with an error (see [Server.ServeError]).
+// This turns errors which would otherwise only be printed into test failures.
+//
+// Note: the cleanup function should run after the server is closed, thus FailOnServeError
+// must be called before registering [Server.Close] with tb.Cleanup (cleanups run in reverse order).
+func (s *Server) FailOnServeError(tb testing.TB) {
+	tb.Helper()
+	tb.Cleanup(func() {
+		if err := s.ServeError(); err != nil {
+			tb.Errorf("grpctest: server stopped serving: %v", err)
+		}
+	})
+}
+
+// setupTLS prepares the TLS configuration of the test server.
 //
 // Note: must be called with s.mu held.
 func (s *Server) setupTLS() error {
-	// Generate private key
-	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	// Work on a copy, so that the hooks and certificate of the server never leak into
+	// the caller's configuration (e.g., shared with other servers)
+	if s.TLS != nil {
+		s.TLS = s.TLS.Clone()
+	}
+	if err := s.setupCertificate(); err != nil {
+		return err
+	}
+	if s.Config.alpn != nil {
+		s.TLS.NextProtos = slices.Clone(s.Config.alpn)
+	}
+	if s.Config.sessionTicketsDisabled {
+		s.TLS.SessionTicketsDisabled = true
+	}
+	s.TLS.GetConfigForClient = s.recordClientHello(s.checkSNI(s.TLS.GetConfigForClient))
+	s.TLS.VerifyConnection = s.recordConnectionState(s.TLS.VerifyConnection)
+	return nil
+}
+
+// setupCertificate generates a self-signed certificate for the test server.
+// If [Server.TLS] is preset with a certificate, it is used as-is.
+// Otherwise, the generated certificate is added to the preset configuration.
+func (s *Server) setupCertificate() error {
+	if s.TLS != nil && hasCertificate(s.TLS) {
+		s.generatedCert = false
+		if len(s.TLS.Certificates) > 0 {
+			cert, err := leafCertificate(s.TLS.Certificates[0])
+			if err != nil {
+				return err
+			}
+			s.cert = cert
+		}
+		return nil
+	}
+
+	cert, tlsCert, err := s.generateCertificate()
 	if err != nil {
-		return fmt.Errorf("failed to generate private key: %w", err)
+		return err
 	}
+	s.cert = cert
+	s.tlsCert.Store(&tlsCert)
+	s.generatedCert = true
 
-	// Create certificate template
-	notBefore := time.Now()
-	notAfter := notBefore.Add(24 * time.Hour)
+	if s.TLS == nil {
+		s.TLS = &tls.Config{
+			MinVersion: tls.VersionTLS13,
+		}
+	}
+
+	// Configure TLS
+	// (the certificate is served only through GetCertificate to support rotation: the
+	// transport credentials hold a copy of the configuration, whose Certificates would be
+	// served to the clients sending no SNI, e.g., dialing an IP address)
+	s.TLS.GetCertificate = s.getCertificate
+
+	return nil
+}
+
+// hasCertificate reports whether config provides a server certificate.
+func hasCertificate(config *tls.Config) bool {
+	return len(config.Certificates) > 0 || config.GetCertificate != nil || config.GetConfigForClient != nil
+}
+
+// leafCertificate returns the parsed leaf of the given certificate chain.
+func leafCertificate(cert tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("empty certificate chain")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return leaf, nil
+}
+
+// getCertificate returns the current certificate of the server.
+// It is used as [tls.Config.GetCertificate] callback.
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.tlsCert.Load(), nil
+}
+
+// generateKey generates the private key of the self-signed certificate.
+// Without custom source of randomness, it is an ECDSA P-256 key. Otherwise, it is an Ed25519 key
+// derived from the bytes read from random: unlike ECDSA, its generation and signatures are
+// deterministic, which makes the certificate reproducible.
+func generateKey(random io.Reader) (crypto.Signer, error) {
+	if random == nil {
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(random, seed); err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
 
-	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+// generateCertificate generates a self-signed certificate for the test server.
+func (s *Server) generateCertificate() (*x509.Certificate, tls.Certificate, error) {
+	random := s.Config.certRand
+	if random == nil {
+		random = rand.Reader
+	}
+	now := s.Config.certClock
+	if now == nil {
+		now = s.Config.clock().now
+	}
+
+	// Generate serial number first: key generation may consume a variable
+	// amount of randomness, which would make the serial number non-reproducible
+	serialNumber, err := rand.Int(random, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, tls.Certificate{}, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	// Generate private key
+	priv, err := generateKey(s.Config.certRand)
 	if err != nil {
-		return fmt.Errorf("failed to generate serial number: %w", err)
+		return nil, tls.Certificate{}, fmt.Errorf("failed to generate private key: %w", err)
 	}
 
+	// Create certificate template
+	subject := pkix.Name{
+		Organization: []string{"grpctest"},
+		CommonName:   "localhost",
+	}
+	if s.Config.certSubject != nil {
+		subject = *s.Config.certSubject
+	}
+	notBefore := now()
+	notAfter := notBefore.Add(24 * time.Hour)
+
 	template := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			Organization: []string{"grpctest"},
-			CommonName:   "localhost",
-		},
+		SerialNumber:          serialNumber,
+		Subject:               subject,
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
@@ -227,41 +1007,37 @@ func (s *Server) setupTLS() error {
 		DNSNames:              []string{"localhost"},
 		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
 	}
+	if name := s.Config.clientServerName; name != "" && name != "localhost" {
+		template.DNSNames = append(template.DNSNames, name)
+	}
 
 	// Create self-signed certificate
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	derBytes, err := x509.CreateCertificate(random, &template, &template, priv.Public(), priv)
 	if err != nil {
-		return fmt.Errorf("failed to create certificate: %w", err)
+		return nil, tls.Certificate{}, fmt.Errorf("failed to create certificate: %w", err)
 	}
 
 	// Parse certificate
 	cert, err := x509.ParseCertificate(derBytes)
 	if err != nil {
-		return fmt.Errorf("failed to parse certificate: %w", err)
+		return nil, tls.Certificate{}, fmt.Errorf("failed to parse certificate: %w", err)
 	}
-	s.cert = cert
 
 	// Encode certificate and key for TLS config
 	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	privBytes, err := x509.MarshalECPrivateKey(priv)
+	privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
 	if err != nil {
-		return fmt.Errorf("failed to marshal private key: %w", err)
+		return nil, tls.Certificate{}, fmt.Errorf("failed to marshal private key: %w", err)
 	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})
 
 	// Create TLS certificate
 	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
 	if err != nil {
-		return fmt.Errorf("failed to create TLS certificate: %w", err)
-	}
-
-	// Configure TLS
-	s.TLS = &tls.Config{
-		Certificates: []tls.Certificate{tlsCert},
-		MinVersion:   tls.VersionTLS13,
+		return nil, tls.Certificate{}, fmt.Errorf("failed to create TLS certificate: %w", err)
 	}
 
-	return nil
+	return cert, tlsCert, nil
 }
 
 // Close shuts down the server and releases all resources.
@@ -274,21 +1050,189 @@ func (s *Server) Close() {
 		return
 	}
 	s.closed = true
+	close(s.done)
 
-	if s.client != nil {
-		s.client.Close() // nolint:errcheck
-		s.client = nil
-	}
-
+	// The server is stopped before the client connections, which lets in-flight RPCs
+	// complete during a graceful stop
 	if s.server != nil {
-		s.server.Stop()
+		stopServer(s.server, s.Config.closeTimeout)
 		s.server = nil
 	}
+	if s.serveErrCh != nil {
+		// Serve returns once the server is stopped
+		s.serveErr = <-s.serveErrCh
+		s.serveErrCh = nil
+	}
+
+	// Close all client connections (including the cached one)
+	for _, conn := range s.conns {
+		conn.Close() // nolint:errcheck
+	}
+	s.conns = nil
+	s.client = nil
+
+	if s.adminServer != nil {
+		s.adminServer.Stop()
+		s.adminServer = nil
+	}
 
 	if s.Listener != nil {
 		s.Listener.Close() // nolint:errcheck
 		s.Listener = nil
+		s.listener = nil
+	}
+
+	for _, hook := range s.Config.postClose {
+		hook()
+	}
+}
+
+// stopServer stops server gracefully within timeout, then forcefully.
+// A zero timeout stops the server immediately.
+func stopServer(server *grpc.Server, timeout time.Duration) {
+	if timeout > 0 {
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(timeout):
+			server.Stop()
+			<-stopped // GracefulStop returns once the server is stopped
+		}
+		return
+	}
+	server.Stop()
+}
+
+// Started reports whether the server has been started.
+// It remains true after the server is closed.
+func (s *Server) Started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// Closed reports whether the server has been closed.
+func (s *Server) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// ConnCount returns the number of client connections created by [Server.ClientConn]
+// which are not closed yet. It is 0 once the server is closed, since [Server.Close]
+// closes them all.
+//
+// This helps catch helpers which forget to close the connections they create.
+func (s *Server) ConnCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, conn := range s.conns {
+		if conn.GetState() != connectivity.Shutdown {
+			count++
+		}
 	}
+	return count
+}
+
+// Network returns the network of the server's listener: "tcp" by default, or "bufconn" for
+// servers listening in memory (see [WithBufconn]). This lets generic helpers dial the server
+// correctly regardless of how it was constructed, without parsing [Server.URL].
+// Returns an empty string if the server is not started or is closed.
+func (s *Server) Network() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Listener == nil {
+		return ""
+	}
+	return s.Listener.Addr().Network()
+}
+
+// ServiceInfo returns the services registered on the server, keyed by full service name
+// (e.g., "hello.Greeter"), including the services added by options such as [WithReflection].
+// Returns nil if the server is not started or is closed.
+//
+// This is useful to verify that a registration helper wired up all the expected RPCs,
+// or to build generic test drivers over arbitrary services.
+func (s *Server) ServiceInfo() map[string]grpc.ServiceInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server == nil {
+		return nil
+	}
+	return s.server.GetServiceInfo()
+}
+
+// Reset clears the state recorded or injected while the server runs (captured data,
+// call counts, injected headers, trailers and errors, rate limits, required metadata, etc.),
+// leaving the server running and its connections intact.
+// Capture features enabled on the server remain enabled.
+//
+// This keeps per-subtest isolation cheap, without recreating the server.
+func (s *Server) Reset() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	s.lastPeer = nil
+	s.lastAuthInfo = nil
+	s.timings = nil
+	s.watchdog = nil
+	s.streamStats = nil
+	s.calls = nil
+	s.recorded = nil
+	s.headers = nil
+	s.trailers = nil
+	s.rateLimits = nil
+	s.transformer = nil
+	s.responses = nil
+	s.blackholes = nil
+	s.requiredMD = nil
+	s.injectedErrs = nil
+	s.streamErrs = nil
+	s.maxReqSizes = nil
+	s.flakiness = nil
+	s.jitter = nil
+	s.latency = 0
+	s.lastRawReq = nil
+	s.lastCompress = ""
+	s.lastHello = nil
+	s.cipherSuite = 0
+	s.handshaked = false
+	s.resumed = false
+	s.expectedSNI = nil
+}
+
+// RotateCertificate generates a new self-signed certificate and serves it for new TLS handshakes.
+// Existing connections are not affected. The new certificate is returned by [Server.Certificate].
+//
+// Note: clients created before the rotation (including the cached one returned by
+// [Server.ClientConn]) only trust the previous certificate, thus their new handshakes fail.
+// Use [Server.ClientConn] with options to create a client trusting the new certificate.
+func (s *Server) RotateCertificate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started || !s.useTLS {
+		return errors.New("grpctest: server not started with TLS")
+	}
+	if !s.generatedCert {
+		return errors.New("grpctest: cannot rotate a user-provided certificate")
+	}
+
+	cert, tlsCert, err := s.generateCertificate()
+	if err != nil {
+		return fmt.Errorf("grpctest: failed to rotate certificate: %w", err)
+	}
+	s.cert = cert
+	s.tlsCert.Store(&tlsCert)
+	return nil
 }
 
 // Certificate returns the server's certificate.
@@ -300,6 +1244,41 @@ func (s *Server) Certificate() *x509.Certificate {
 	return s.cert
 }
 
+// PrivateKey returns the private key of the server's generated certificate.
+// It is useful to build advanced TLS fixtures (e.g., signing a bogus certificate with the server's key).
+// Returns nil if the server is not using TLS or if its certificate was provided by the user.
+func (s *Server) PrivateKey() crypto.Signer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.generatedCert {
+		return nil
+	}
+	signer, _ := s.tlsCert.Load().PrivateKey.(crypto.Signer)
+	return signer
+}
+
+// ClientTLSConfig returns a TLS configuration trusting the server's certificate, with the
+// expected server name. It is the configuration used by [Server.ClientConn], and is useful
+// to compose your own credentials when creating client connections manually.
+// Each call returns a new configuration, which can be modified freely.
+// Returns nil if the server is not using TLS.
+//
+// Example:
+//
+//	conn, err := grpc.NewClient(server.URL, grpc.WithTransportCredentials(
+//		credentials.NewTLS(server.ClientTLSConfig()),
+//	))
+func (s *Server) ClientTLSConfig() *tls.Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.useTLS {
+		return nil
+	}
+	return s.clientTLSConfig()
+}
+
 // ClientConn returns a gRPC client connection to the test server.
 // For TLS servers, the client is configured to trust the server's self-signed certificate
 // unless custom transport credentials are provided via opts.
@@ -311,7 +1290,7 @@ func (s *Server) Certificate() *x509.Certificate {
 //   - when called without options, the connection is cached and reused on subsequent calls.
 //   - when called with options, a new connection is created each time (no caching).
 //   - the connection will be closed when the server is closed.
-//   - this method panics if the server is not started.
+//   - this method panics if the server is not started or is closed.
 func (s *Server) ClientConn(opts ...grpc.DialOption) grpc.ClientConnInterface {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -319,12 +1298,22 @@ func (s *Server) ClientConn(opts ...grpc.DialOption) grpc.ClientConnInterface {
 	if !s.started {
 		panic("grpctest: server not started")
 	}
+	if s.closed {
+		panic("grpctest: server closed")
+	}
 
 	// If custom options are provided, create a new client (no caching)
 	if len(opts) > 0 {
 		return s.createClient(opts...)
 	}
 
+	return s.defaultClient()
+}
+
+// defaultClient returns the cached client connection, creating it if needed.
+//
+// Note: must be called with s.mu held.
+func (s *Server) defaultClient() *grpc.ClientConn {
 	// Use cached client if available
 	if s.client != nil {
 		return s.client
@@ -335,37 +1324,89 @@ func (s *Server) ClientConn(opts ...grpc.DialOption) grpc.ClientConnInterface {
 	return s.client
 }
 
+// clientTLSConfig returns the TLS configuration of the clients created by the server.
+// It trusts the server's certificate, or the system roots if the certificate is unknown
+// (e.g., served by a custom GetCertificate).
+//
+// Note: must be called with s.mu held.
+func (s *Server) clientTLSConfig() *tls.Config {
+	config := &tls.Config{
+		ServerName:         cmp.Or(s.Config.clientServerName, "localhost"),
+		InsecureSkipVerify: s.Config.clientInsecureSkipVerify, // nolint:gosec // opt-in for negative tests
+		Time:               s.Config.now,                      // verifies the certificate in the server's virtual time, if any
+		CipherSuites:       slices.Clone(s.Config.clientCipherSuites),
+	}
+	if s.cert != nil {
+		config.RootCAs = x509.NewCertPool()
+		config.RootCAs.AddCert(s.cert)
+	}
+	return config
+}
+
 // createClient creates a new gRPC client connection with the given options.
-// Default transport credentials are added first, then user options are appended,
+// Default options are added first, then user options are appended,
 // allowing user options to override defaults.
 //
-// Note: this method panics if the connection fails.
+// The connection is tracked to be closed by [Server.Close].
+//
+// Note: this method panics if the server is closed (the connection would never be closed)
+// or if the connection fails, and must be called with s.mu held.
 func (s *Server) createClient(opts ...grpc.DialOption) *grpc.ClientConn {
-	// Start with default options
-	finalOpts := make([]grpc.DialOption, 0, len(opts)+1)
+	if s.closed {
+		panic("grpctest: server closed")
+	}
 
-	// Add default transport credentials first
+	// Default transport credentials
+	creds := insecure.NewCredentials()
 	if s.useTLS {
-		// Create cert pool with server's certificate
-		certPool := x509.NewCertPool()
-		certPool.AddCert(s.cert)
-
-		creds := credentials.NewTLS(&tls.Config{
-			RootCAs:    certPool,
-			ServerName: "localhost",
-		})
-		finalOpts = append(finalOpts, grpc.WithTransportCredentials(creds))
-	} else {
-		finalOpts = append(finalOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		creds = credentials.NewTLS(s.clientTLSConfig())
 	}
 
-	// Append user options (these will override defaults if they conflict)
-	finalOpts = append(finalOpts, opts...)
+	target := s.URL
+	var defaultOpts []grpc.DialOption
+	if s.bufListener != nil {
+		// Dial the in-memory listener (user options may still override the dialer)
+		lis := s.bufListener
+		target = "passthrough:///" + s.URL
+		defaultOpts = append(defaultOpts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	}
 
-	conn, err := grpc.NewClient(s.URL, finalOpts...)
+	// Add options matching the server configuration, then user options
+	// (these will override defaults if they conflict)
+	defaultOpts = append(defaultOpts, s.Config.dialOptions()...)
+	conn, err := newClient(target, creds, append(defaultOpts, opts...)...)
 	if err != nil {
 		panic(fmt.Sprintf("grpctest: failed to dial server: %v", err))
 	}
+	s.conns = append(s.conns, conn)
 
 	return conn
 }
+
+// newClient creates a gRPC client connection to target using the given transport credentials,
+// which can be overridden by opts.
+// It is the dial logic shared by [Server.ClientConn] and [InsecureClient].
+func newClient(target string, creds credentials.TransportCredentials, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return grpc.NewClient(target, append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, opts...)...)
+}
+
+// InsecureClient creates a plain text client connection to an arbitrary target (e.g., a second
+// gRPC endpoint used by the test), with the same dial logic as [Server.ClientConn].
+// The returned cleanup function closes the connection.
+//
+// Example:
+//
+//	conn, cleanup, err := grpctest.InsecureClient("localhost:50051")
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer cleanup()
+func InsecureClient(target string) (grpc.ClientConnInterface, func(), error) {
+	conn, err := newClient(target, insecure.NewCredentials())
+	if err != nil {
+		return nil, nil, fmt.Errorf("grpctest: failed to dial %s: %w", target, err)
+	}
+	return conn, func() { conn.Close() }, nil // nolint:errcheck
+}
@@ -2,6 +2,11 @@ package grpctest_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +15,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -401,3 +407,553 @@ func TestClientConnNoCachingWithOptions(t *testing.T) {
 		t.Error("expected ClientConn() without options to return the same instance")
 	}
 }
+
+func TestReset(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	server.EnablePeerCapture()
+	server.SetHeaderForMethod("/hello.Greeter/SayHello", metadata.Pairs("x-injected", "true"))
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx := context.Background()
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if server.LastPeer() == nil {
+		t.Fatal("expected peer to be captured")
+	}
+
+	server.Reset()
+	if server.LastPeer() != nil {
+		t.Error("expected captured peer to be cleared")
+	}
+
+	// The server keeps serving with the same connection, without injected headers
+	var header metadata.MD
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}, grpc.Header(&header)); err != nil {
+		t.Fatalf("unexpected error after reset: %v", err)
+	}
+	if got := header.Get("x-injected"); len(got) != 0 {
+		t.Errorf("expected injected header to be cleared, got %v", got)
+	}
+	if server.LastPeer() == nil {
+		t.Error("expected peer capture to remain enabled")
+	}
+}
+
+func TestServerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []grpctest.Option
+		wantErr bool
+	}{
+		{
+			name: "valid configuration",
+			opts: []grpctest.Option{grpctest.WithMaxRecvMsgSize(1024), grpctest.WithInitialWindowSize(1 << 20)},
+		},
+		{
+			name:    "negative max receive message size",
+			opts:    []grpctest.Option{grpctest.WithMaxRecvMsgSize(-1)},
+			wantErr: true,
+		},
+		{
+			name:    "too small initial window size",
+			opts:    []grpctest.Option{grpctest.WithInitialWindowSize(1024)},
+			wantErr: true,
+		},
+		{
+			name:    "too small initial connection window size",
+			opts:    []grpctest.Option{grpctest.WithInitialConnWindowSize(1024)},
+			wantErr: true,
+		},
+		{
+			name:    "OK unknown method code",
+			opts:    []grpctest.Option{grpctest.WithUnknownMethodCode(codes.OK)},
+			wantErr: true,
+		},
+		{
+			name:    "negative connection timeout",
+			opts:    []grpctest.Option{grpctest.WithConnectionTimeout(-time.Second)},
+			wantErr: true,
+		},
+		{
+			name:    "negative max connection idle",
+			opts:    []grpctest.Option{grpctest.WithMaxConnectionIdle(-time.Second)},
+			wantErr: true,
+		},
+		{
+			name:    "invalid client service config",
+			opts:    []grpctest.Option{grpctest.WithClientServiceConfig(`{"methodConfig": [`)},
+			wantErr: true,
+		},
+		{
+			name:    "negative recorder capacity",
+			opts:    []grpctest.Option{grpctest.WithRecorderCapacity(-1)},
+			wantErr: true,
+		},
+		{
+			name:    "negative close timeout",
+			opts:    []grpctest.Option{grpctest.WithCloseTimeout(-time.Second)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := grpctest.NewUnstartedServer(nil, tt.opts...)
+			err := server.Config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStartRejectsTLSOptions(t *testing.T) {
+	server := grpctest.NewUnstartedServer(nil, grpctest.WithCertClock(time.Now))
+	defer server.Close()
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("expected Start to panic")
+		}
+		if !strings.Contains(fmt.Sprint(r), "WithCertClock require TLS") {
+			t.Errorf("unexpected panic message: %v", r)
+		}
+	}()
+	server.Start()
+}
+
+func BenchmarkNewBenchServer(b *testing.B) {
+	server := grpctest.NewBenchServer(b, func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx := context.Background()
+
+	for b.Loop() {
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "bench"}); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestLifecycleState(t *testing.T) {
+	server := grpctest.NewUnstartedServer(nil)
+	if server.Started() || server.Closed() {
+		t.Fatalf("expected unstarted server, got started=%v closed=%v", server.Started(), server.Closed())
+	}
+
+	server.Start()
+	if !server.Started() || server.Closed() {
+		t.Fatalf("expected started server, got started=%v closed=%v", server.Started(), server.Closed())
+	}
+
+	server.Close()
+	if !server.Started() || !server.Closed() {
+		t.Fatalf("expected closed server, got started=%v closed=%v", server.Started(), server.Closed())
+	}
+}
+
+func TestConnCount(t *testing.T) {
+	server := grpctest.NewServer(nil)
+
+	if got := server.ConnCount(); got != 0 {
+		t.Fatalf("expected no connection, got %d", got)
+	}
+
+	server.ClientConn()
+	server.ClientConn() // cached
+	conn := server.ClientConn(grpc.WithUserAgent("grpctest"))
+	server.ClientConn(grpc.WithUserAgent("grpctest"))
+	if got := server.ConnCount(); got != 3 {
+		t.Fatalf("expected 3 connections, got %d", got)
+	}
+
+	if err := conn.(*grpc.ClientConn).Close(); err != nil {
+		t.Fatalf("failed to close connection: %v", err)
+	}
+	if got := server.ConnCount(); got != 2 {
+		t.Fatalf("expected 2 connections after closing one, got %d", got)
+	}
+
+	server.Close()
+	if got := server.ConnCount(); got != 0 {
+		t.Errorf("expected no connection after Close, got %d", got)
+	}
+
+	// No connection is created (and leaked) once the server is closed
+	for name, opts := range map[string][]grpc.DialOption{
+		"cached":  nil,
+		"options": {grpc.WithUserAgent("grpctest")},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("%s: expected ClientConn to panic on a closed server", name)
+				}
+			}()
+			server.ClientConn(opts...)
+		}()
+	}
+	if got := server.ConnCount(); got != 0 {
+		t.Errorf("expected no connection after ClientConn on a closed server, got %d", got)
+	}
+}
+
+func TestFreePort(t *testing.T) {
+	port, err := grpctest.FreePort()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if port <= 0 {
+		t.Fatalf("expected a positive port, got %d", port)
+	}
+
+	// The port is released, hence it can be bound
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("expected port %d to be free: %v", port, err)
+	}
+	listener.Close()
+}
+
+func TestInsecureClient(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	conn, cleanup, err := grpctest.InsecureClient(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cleanup()
+
+	reply, err := pb.NewGreeterClient(conn).SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reply.Message != "Hello World" {
+		t.Errorf("unexpected reply: %q", reply.Message)
+	}
+}
+
+func TestInsecureClientInvalidTarget(t *testing.T) {
+	if _, _, err := grpctest.InsecureClient("dns://%zz/target"); err == nil {
+		t.Error("expected error for an invalid target")
+	}
+}
+
+func TestClone(t *testing.T) {
+	base := grpctest.NewUnstartedServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithMaxRecvMsgSize(1024))
+	defer base.Close()
+
+	// Each clone can be configured and started independently
+	clone1 := base.Clone()
+	clone1.Config.ServerOptions = append(clone1.Config.ServerOptions, grpc.MaxSendMsgSize(1))
+	clone1.Start()
+	defer clone1.Close()
+
+	clone2 := base.Clone()
+	clone2.StartTLS()
+	defer clone2.Close()
+
+	if len(base.Config.ServerOptions) != 0 {
+		t.Errorf("expected base options to be unchanged, got %d options", len(base.Config.ServerOptions))
+	}
+	if base.Started() {
+		t.Error("expected base server not to be started")
+	}
+
+	// The registration function and options are cloned
+	ctx := context.Background()
+	_, err := pb.NewGreeterClient(clone1.ClientConn()).SayHello(ctx, &pb.HelloRequest{Name: "World"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted from the send limit of clone1, got %v", err)
+	}
+	_, err = pb.NewGreeterClient(clone2.ClientConn()).SayHello(ctx, &pb.HelloRequest{Name: strings.Repeat("x", 2048)})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted from the receive limit of clone2, got %v", err)
+	}
+	if _, err := pb.NewGreeterClient(clone2.ClientConn()).SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCloneStartedServer(t *testing.T) {
+	server := grpctest.NewServer(nil)
+	defer server.Close()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected Clone to panic on a started server")
+		}
+	}()
+	server.Clone()
+}
+
+func TestServeError(t *testing.T) {
+	server := grpctest.NewServer(nil)
+	if err := server.ServeError(); err != nil {
+		t.Errorf("expected no serve error while serving, got %v", err)
+	}
+
+	server.Close()
+	if err := server.ServeError(); err != nil {
+		t.Errorf("expected no serve error after a normal shutdown, got %v", err)
+	}
+}
+
+func TestServeErrorListenerFailure(t *testing.T) {
+	server := grpctest.NewServer(nil)
+	defer server.Close()
+
+	breakListener(t, server)
+}
+
+// breakListener closes the listener behind the server's back, which makes Serve fail,
+// and waits for the failure to be recorded.
+func breakListener(t *testing.T, server *grpctest.Server) {
+	t.Helper()
+	server.Listener.Close() // nolint:errcheck
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.ServeError() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the serve error")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFailOnServeError(t *testing.T) {
+	tests := []struct {
+		name        string
+		breakServer bool
+		wantFailure bool
+	}{
+		{name: "normal shutdown", breakServer: false, wantFailure: false},
+		{name: "listener failure", breakServer: true, wantFailure: true},
+	}
+
+	for _, tt := range tests {
+		recorder := &errorRecorder{}
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.TB = t
+			server := grpctest.NewServer(nil)
+			server.FailOnServeError(recorder)
+			t.Cleanup(server.Close)
+
+			if tt.breakServer {
+				breakListener(t, server)
+			}
+		})
+		if recorder.failed != tt.wantFailure {
+			t.Errorf("expected failure %v, got %v", tt.wantFailure, recorder.failed)
+		}
+	}
+}
+
+func TestNewServerWithSelf(t *testing.T) {
+	drained := make(chan (<-chan struct{}), 1)
+	server := grpctest.NewServerWithSelf(func(s *grpc.Server, ts *grpctest.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				if req.Name == "shutdown" {
+					drained <- ts.BeginDrain()
+				}
+				return &pb.HelloReply{Message: "Hello " + req.Name}, nil
+			},
+		})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "shutdown"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case <-<-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the server to be drained by the handler")
+	}
+	if !server.Closed() {
+		t.Error("expected the server to be closed")
+	}
+}
+
+func TestServiceInfo(t *testing.T) {
+	server := grpctest.NewUnstartedServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	if info := server.ServiceInfo(); info != nil {
+		t.Errorf("expected nil service info before start, got %v", info)
+	}
+
+	server.Start()
+	defer server.Close()
+
+	info, ok := server.ServiceInfo()["hello.Greeter"]
+	if !ok {
+		t.Fatalf("expected hello.Greeter to be registered, got %v", server.ServiceInfo())
+	}
+	var methods []string
+	for _, method := range info.Methods {
+		methods = append(methods, method.Name)
+	}
+	slices.Sort(methods)
+	if want := []string{"SayHello", "SayHelloClientStream", "SayHelloStream"}; !slices.Equal(methods, want) {
+		t.Errorf("expected methods %v, got %v", want, methods)
+	}
+
+	server.Close()
+	if info := server.ServiceInfo(); info != nil {
+		t.Errorf("expected nil service info once closed, got %v", info)
+	}
+}
+
+func TestWithCloseTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		release bool // whether the in-flight RPC completes within the timeout
+		wantErr bool
+	}{
+		{name: "graceful", release: true, wantErr: false},
+		{name: "forced", release: false, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entered, release := make(chan struct{}), make(chan struct{})
+			server := grpctest.NewServer(func(s *grpc.Server) {
+				pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+					SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+						close(entered)
+						select {
+						case <-release:
+							return &pb.HelloReply{Message: "Hello " + req.Name}, nil
+						case <-ctx.Done():
+							return nil, ctx.Err()
+						}
+					},
+				})
+			}, grpctest.WithCloseTimeout(200*time.Millisecond))
+
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := pb.NewGreeterClient(server.ClientConn()).SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+				errCh <- err
+			}()
+			<-entered
+
+			closed := make(chan struct{})
+			go func() {
+				server.Close()
+				close(closed)
+			}()
+			if tc.release {
+				// Let Close begin before the RPC completes
+				time.Sleep(50 * time.Millisecond)
+				close(release)
+			}
+
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected Close to return")
+			}
+			if err := <-errCh; (err != nil) != tc.wantErr {
+				t.Errorf("expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStartAfterClose(t *testing.T) {
+	for name, start := range map[string]func(*grpctest.Server){
+		"Start":    (*grpctest.Server).Start,
+		"StartTLS": (*grpctest.Server).StartTLS,
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := grpctest.NewUnstartedServer(nil)
+			server.Close()
+
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic when starting a closed server")
+				}
+				if server.Started() {
+					t.Error("expected the closed server not to be started")
+				}
+			}()
+			start(server)
+		})
+	}
+}
+
+func TestStartWithTimeout(t *testing.T) {
+	register := func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}
+
+	t.Run("started", func(t *testing.T) {
+		server := grpctest.NewUnstartedServer(register)
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.StartWithTimeout(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := pb.NewGreeterClient(server.ClientConn()).SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		server := grpctest.NewUnstartedServer(register)
+		defer server.Close()
+
+		if err := server.StartWithTimeout(grpctest.CanceledContext()); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("invalid configuration", func(t *testing.T) {
+		server := grpctest.NewUnstartedServer(register, grpctest.WithStrictTLS())
+		defer server.Close()
+
+		if err := server.StartWithTimeout(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+			t.Errorf("expected an invalid configuration error, got %v", err)
+		}
+	})
+}
+
+func TestNetwork(t *testing.T) {
+	for _, tc := range []struct {
+		opts []grpctest.Option
+		want string
+	}{
+		{want: "tcp"},
+		{opts: []grpctest.Option{grpctest.WithBufconn()}, want: "bufconn"},
+	} {
+		t.Run(tc.want, func(t *testing.T) {
+			server := grpctest.NewUnstartedServer(nil, tc.opts...)
+			if got := server.Network(); got != "" {
+				t.Errorf("expected no network before start, got %q", got)
+			}
+
+			server.Start()
+			defer server.Close()
+			if got := server.Network(); got != tc.want {
+				t.Errorf("expected network %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -2,9 +2,19 @@ package grpctest
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"testing"
 
 	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 // GreeterServer is a helper implementation of [pb.GreeterServer] designed for testing.
@@ -33,6 +43,11 @@ type GreeterServer struct {
 	// If nil, uses the default behavior: reads the first message from client,
 	// sends back "hello <name>, I'm sorry I'm busy..., bye", and closes the stream.
 	SayHelloStreamHandler func(pb.Greeter_SayHelloStreamServer) error
+
+	// SayHelloClientStreamHandler is an optional handler for the SayHelloClientStream client streaming RPC.
+	// If nil, uses the default behavior: receives all the messages from the client,
+	// then replies with "Hello <name1>, <name2>, ...".
+	SayHelloClientStreamHandler func(pb.Greeter_SayHelloClientStreamServer) error
 }
 
 // SayHello implements [pb.GreeterServer.SayHello].
@@ -69,3 +84,185 @@ func (g *GreeterServer) SayHelloStream(stream pb.Greeter_SayHelloStreamServer) e
 
 	return nil
 }
+
+// SayHelloClientStream implements [pb.GreeterServer.SayHelloClientStream].
+// If [GreeterServer.SayHelloClientStreamHandler] is set, it delegates to that handler.
+// Otherwise, uses default behavior: receives all the messages from the client,
+// then replies with "Hello <name1>, <name2>, ...".
+func (g *GreeterServer) SayHelloClientStream(stream pb.Greeter_SayHelloClientStreamServer) error {
+	if g.SayHelloClientStreamHandler != nil {
+		return g.SayHelloClientStreamHandler(stream)
+	}
+
+	// Default implementation: aggregate the names until the client closes the stream
+	var names []string
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive: %w", err)
+		}
+		names = append(names, req.Name)
+	}
+
+	return stream.SendAndClose(&pb.HelloReply{Message: "Hello " + strings.Join(names, ", ")})
+}
+
+// GreeterClientStream opens a SayHelloClientStream client streaming RPC on the client
+// returned by [Server.ClientConn]. The server must have registered a [pb.GreeterServer]
+// (e.g., [GreeterServer]).
+//
+// Example:
+//
+//	stream, err := server.GreeterClientStream(ctx)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	stream.Send(&pb.HelloRequest{Name: "Alice"})
+//	stream.Send(&pb.HelloRequest{Name: "Bob"})
+//	reply, err := stream.CloseAndRecv() // "Hello Alice, Bob"
+func (s *Server) GreeterClientStream(ctx context.Context) (pb.Greeter_SayHelloClientStreamClient, error) {
+	return pb.NewGreeterClient(s.ClientConn()).SayHelloClientStream(ctx)
+}
+
+// DirectClient returns a [pb.GreeterClient] calling the greeter registered with [WithGreeter]
+// in-process, without any transport nor serialization. This is the fastest way to unit test
+// handler logic when the network layer is irrelevant.
+//
+// Requests and responses are copied, as they would be by serialization, and the outgoing
+// metadata of the context is passed to the handler as incoming metadata. However, the server's
+// interceptors (including the injection and capture features) are bypassed.
+// Only the unary SayHello RPC is supported: streaming RPCs fail with [codes.Unimplemented].
+//
+// Note: this method panics if the server was not created with [WithGreeter].
+func (s *Server) DirectClient() pb.GreeterClient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Config.greeter == nil {
+		panic("grpctest: DirectClient requires the WithGreeter option")
+	}
+	return &directGreeterClient{greeter: s.Config.greeter}
+}
+
+// directGreeterClient is a [pb.GreeterClient] calling a [pb.GreeterServer] in-process.
+type directGreeterClient struct {
+	greeter pb.GreeterServer
+}
+
+// SayHello calls the SayHello handler of the greeter directly.
+func (c *directGreeterClient) SayHello(ctx context.Context, in *pb.HelloRequest, _ ...grpc.CallOption) (*pb.HelloReply, error) {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		ctx = metadata.NewIncomingContext(ctx, md.Copy())
+	}
+	reply, err := c.greeter.SayHello(ctx, proto.CloneOf(in))
+	if err != nil {
+		// Errors which are not statuses are reported as Unknown, as over the network
+		return nil, status.Convert(err).Err()
+	}
+	return proto.CloneOf(reply), nil
+}
+
+// SayHelloStream is not supported by direct clients.
+func (c *directGreeterClient) SayHelloStream(context.Context, ...grpc.CallOption) (grpc.BidiStreamingClient[pb.HelloRequest, pb.HelloReply], error) {
+	return nil, status.Error(codes.Unimplemented, "grpctest: streaming RPCs are not supported by direct clients")
+}
+
+// SayHelloClientStream is not supported by direct clients.
+func (c *directGreeterClient) SayHelloClientStream(context.Context, ...grpc.CallOption) (grpc.ClientStreamingClient[pb.HelloRequest, pb.HelloReply], error) {
+	return nil, status.Error(codes.Unimplemented, "grpctest: streaming RPCs are not supported by direct clients")
+}
+
+// StubServer returns a handler responding to every unary method with reply, to be installed with
+// [grpc.UnknownServiceHandler] on a server without registered services. This stands up a dummy
+// backend instantly, without implementing any service interface, e.g., to scaffold client tests.
+// The reply must be of the output type of the called methods (or of a wire-compatible type).
+//
+// Example:
+//
+//	server := grpctest.NewUnstartedServer(nil)
+//	server.Config.ServerOptions = append(server.Config.ServerOptions,
+//		grpc.UnknownServiceHandler(grpctest.StubServer(&pb.HelloReply{Message: "stub"})),
+//	)
+//	server.Start()
+func StubServer(reply proto.Message) grpc.StreamHandler {
+	reply = proto.Clone(reply)
+	return func(_ any, stream grpc.ServerStream) error {
+		// The request is decoded as an empty message, which keeps its fields as unknown fields
+		if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+			return err
+		}
+		return stream.SendMsg(reply)
+	}
+}
+
+// T returns a wrapper of tb prefixing its log and failure messages with the URL of the server
+// (e.g., "[127.0.0.1:12345] unexpected error"). When several servers run concurrently, this makes
+// failure messages attributable to a specific server without manual annotation.
+// The URL is read when T is called, thus the server should be started beforehand.
+//
+// Example:
+//
+//	t := server.T(t)
+//	t.Errorf("unexpected reply: %v", reply) // [127.0.0.1:12345] unexpected reply: ...
+func (s *Server) T(tb testing.TB) testing.TB {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &serverTB{TB: tb, prefix: "[" + s.URL + "] "}
+}
+
+// serverTB wraps a [testing.TB] to prefix its log and failure messages.
+type serverTB struct {
+	testing.TB
+	prefix string
+}
+
+// Log formats args like [fmt.Sprint] and logs them, prefixed.
+func (t *serverTB) Log(args ...any) {
+	t.Helper()
+	t.TB.Log(t.prefix + fmt.Sprint(args...))
+}
+
+// Logf formats args like [fmt.Sprintf] and logs them, prefixed.
+func (t *serverTB) Logf(format string, args ...any) {
+	t.Helper()
+	t.TB.Log(t.prefix + fmt.Sprintf(format, args...))
+}
+
+// Error is equivalent to Log followed by Fail, prefixed.
+func (t *serverTB) Error(args ...any) {
+	t.Helper()
+	t.TB.Error(t.prefix + fmt.Sprint(args...))
+}
+
+// Errorf is equivalent to Logf followed by Fail, prefixed.
+func (t *serverTB) Errorf(format string, args ...any) {
+	t.Helper()
+	t.TB.Error(t.prefix + fmt.Sprintf(format, args...))
+}
+
+// Fatal is equivalent to Log followed by FailNow, prefixed.
+func (t *serverTB) Fatal(args ...any) {
+	t.Helper()
+	t.TB.Fatal(t.prefix + fmt.Sprint(args...))
+}
+
+// Fatalf is equivalent to Logf followed by FailNow, prefixed.
+func (t *serverTB) Fatalf(format string, args ...any) {
+	t.Helper()
+	t.TB.Fatal(t.prefix + fmt.Sprintf(format, args...))
+}
+
+// Skip is equivalent to Log followed by SkipNow, prefixed.
+func (t *serverTB) Skip(args ...any) {
+	t.Helper()
+	t.TB.Skip(t.prefix + fmt.Sprint(args...))
+}
+
+// Skipf is equivalent to Logf followed by SkipNow, prefixed.
+func (t *serverTB) Skipf(format string, args ...any) {
+	t.Helper()
+	t.TB.Skip(t.prefix + fmt.Sprintf(format, args...))
+}
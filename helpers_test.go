@@ -0,0 +1,172 @@
+package grpctest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGreeterClientStream(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	stream, err := server.GreeterClientStream(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+	}
+	reply, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "Hello Alice, Bob, Carol"; reply.Message != want {
+		t.Errorf("expected %q, got %q", want, reply.Message)
+	}
+}
+
+func TestGreeterClientStreamHandler(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloClientStreamHandler: func(stream pb.Greeter_SayHelloClientStreamServer) error {
+				return stream.SendAndClose(&pb.HelloReply{Message: "custom"})
+			},
+		})
+	})
+	defer server.Close()
+
+	stream, err := server.GreeterClientStream(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	reply, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reply.Message != "custom" {
+		t.Errorf("expected custom reply, got %q", reply.Message)
+	}
+}
+
+func TestDirectClient(t *testing.T) {
+	greeter := &grpctest.GreeterServer{
+		SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+			switch req.Name {
+			case "":
+				return nil, status.Error(codes.InvalidArgument, "missing name")
+			case "plain":
+				return nil, errors.New("plain error")
+			}
+			md, _ := metadata.FromIncomingContext(ctx)
+			return &pb.HelloReply{Message: "Hello " + req.Name + strings.Join(md.Get("suffix"), "")}, nil
+		},
+	}
+	server := grpctest.NewServer(nil, grpctest.WithGreeter(greeter))
+	defer server.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "suffix", "!")
+	for _, client := range []pb.GreeterClient{server.DirectClient(), pb.NewGreeterClient(server.ClientConn())} {
+		reply, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reply.Message != "Hello World!" {
+			t.Errorf("expected 'Hello World!', got %q", reply.Message)
+		}
+
+		_, err = client.SayHello(ctx, &pb.HelloRequest{})
+		if code := status.Code(err); code != codes.InvalidArgument {
+			t.Errorf("expected InvalidArgument, got %v", code)
+		}
+		_, err = client.SayHello(ctx, &pb.HelloRequest{Name: "plain"})
+		if code := status.Code(err); code != codes.Unknown {
+			t.Errorf("expected Unknown for a plain error, got %v", code)
+		}
+	}
+
+	if _, err := server.DirectClient().SayHelloStream(ctx); status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented for streaming RPCs, got %v", err)
+	}
+}
+
+func TestDirectClientWithoutGreeter(t *testing.T) {
+	server := grpctest.NewServer(nil)
+	defer server.Close()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic without WithGreeter")
+		}
+	}()
+	server.DirectClient()
+}
+
+func TestStubServer(t *testing.T) {
+	server := grpctest.NewUnstartedServer(nil)
+	server.Config.ServerOptions = append(server.Config.ServerOptions,
+		grpc.UnknownServiceHandler(grpctest.StubServer(&pb.HelloReply{Message: "stub"})),
+	)
+	server.Start()
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	for _, name := range []string{"Alice", "Bob"} {
+		reply, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: name})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reply.Message != "stub" {
+			t.Errorf("expected 'stub', got %q", reply.Message)
+		}
+	}
+}
+
+func TestServerT(t *testing.T) {
+	server := grpctest.NewServer(nil)
+	defer server.Close()
+
+	recorder := &outputRecorder{TB: t}
+	tb := server.T(recorder)
+	tb.Logf("calling %s", "SayHello")
+	tb.Errorf("unexpected reply: %q", "Hi")
+
+	prefix := "[" + server.URL + "] "
+	want := []string{prefix + "calling SayHello", prefix + `unexpected reply: "Hi"`}
+	if !slices.Equal(recorder.output, want) {
+		t.Errorf("expected output %q, got %q", want, recorder.output)
+	}
+	if !recorder.failed {
+		t.Error("expected the test to be marked as failed")
+	}
+}
+
+// outputRecorder is a [testing.TB] recording the output of Log and Error.
+type outputRecorder struct {
+	testing.TB
+	output []string
+	failed bool
+}
+
+func (r *outputRecorder) Log(args ...any) {
+	r.output = append(r.output, fmt.Sprint(args...))
+}
+
+func (r *outputRecorder) Error(args ...any) {
+	r.output = append(r.output, fmt.Sprint(args...))
+	r.failed = true
+}
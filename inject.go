@@ -0,0 +1,620 @@
+package grpctest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// Pause blocks all incoming RPCs until [Server.Resume] is called.
+// Blocked RPCs respect the cancellation of their context and fail with
+// [codes.Unavailable] if the server is closed while paused.
+//
+// This is useful to test client timeouts and queueing.
+func (s *Server) Pause() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.pauseGate == nil {
+		s.pauseGate = make(chan struct{})
+	}
+}
+
+// Resume releases the RPCs blocked by [Server.Pause].
+// It does nothing if the server is not paused.
+func (s *Server) Resume() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.pauseGate != nil {
+		close(s.pauseGate)
+		s.pauseGate = nil
+	}
+}
+
+// waitIfPaused blocks while the server is paused.
+// It returns an error if ctx is done or if the server is closed before being resumed.
+func (s *Server) waitIfPaused(ctx context.Context) error {
+	s.stateMu.Lock()
+	gate := s.pauseGate
+	s.stateMu.Unlock()
+
+	if gate == nil {
+		return nil
+	}
+
+	select {
+	case <-gate:
+		return nil
+	case <-s.done:
+		return status.Error(codes.Unavailable, "grpctest: server closed while paused")
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// SetHeaderForMethod sets response headers sent by the server for the given full method
+// (e.g., "/hello.Greeter/SayHello"). Headers set by the handler are merged with md.
+//
+// This is useful to test client code parsing method-specific metadata.
+func (s *Server) SetHeaderForMethod(fullMethod string, md metadata.MD) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.headers == nil {
+		s.headers = make(map[string]metadata.MD)
+	}
+	s.headers[fullMethod] = md.Copy()
+}
+
+// SetTrailerForMethod sets response trailers sent by the server for the given full method
+// (e.g., "/hello.Greeter/SayHello"). Trailers set by the handler are merged with md.
+//
+// This is useful to test client code parsing method-specific trailing metadata (e.g., rate-limit headers).
+func (s *Server) SetTrailerForMethod(fullMethod string, md metadata.MD) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.trailers == nil {
+		s.trailers = make(map[string]metadata.MD)
+	}
+	s.trailers[fullMethod] = md.Copy()
+}
+
+// methodMetadata returns the headers and trailers to send for the given full method,
+// including the echoed request metadata when [WithMetadataEcho] is used.
+func (s *Server) methodMetadata(ctx context.Context, fullMethod string) (header, trailer metadata.MD) {
+	s.stateMu.Lock()
+	header, trailer = s.headers[fullMethod], s.trailers[fullMethod]
+	s.stateMu.Unlock()
+
+	if s.Config.metadataEcho {
+		trailer = metadata.Join(trailer, echoMetadata(ctx))
+	}
+	return header, trailer
+}
+
+// MetadataEchoPrefix prefixes the keys of the request metadata echoed in the response trailers
+// by a server created with [WithMetadataEcho].
+const MetadataEchoPrefix = "echo-"
+
+// echoMetadata returns the incoming metadata of ctx with keys prefixed by [MetadataEchoPrefix].
+// Pseudo-headers (e.g., ":authority") are skipped since they cannot be sent as trailers.
+func echoMetadata(ctx context.Context) metadata.MD {
+	md, _ := metadata.FromIncomingContext(ctx)
+	echo := make(metadata.MD, len(md))
+	for key, values := range md {
+		if strings.HasPrefix(key, ":") {
+			continue
+		}
+		echo[MetadataEchoPrefix+key] = slices.Clone(values)
+	}
+	return echo
+}
+
+// setUnaryMetadata sets the headers and trailers configured for the given full method on a unary RPC.
+func (s *Server) setUnaryMetadata(ctx context.Context, fullMethod string) error {
+	header, trailer := s.methodMetadata(ctx, fullMethod)
+	if header != nil {
+		if err := grpc.SetHeader(ctx, header); err != nil {
+			return err
+		}
+	}
+	if trailer != nil {
+		if err := grpc.SetTrailer(ctx, trailer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setStreamMetadata sets the headers and trailers configured for the given full method on a stream.
+func (s *Server) setStreamMetadata(ss grpc.ServerStream, fullMethod string) error {
+	header, trailer := s.methodMetadata(ss.Context(), fullMethod)
+	if header != nil {
+		if err := ss.SetHeader(header); err != nil {
+			return err
+		}
+	}
+	if trailer != nil {
+		ss.SetTrailer(trailer)
+	}
+	return nil
+}
+
+// SetRateLimit limits the given full method (e.g., "/hello.Greeter/SayHello") to perSecond calls
+// per second, with a burst of perSecond calls. Calls exceeding the rate fail with
+// [codes.ResourceExhausted]. A perSecond lower than or equal to 0 removes the limit.
+//
+// This is useful to verify that client retries and backoff respect rate limits.
+func (s *Server) SetRateLimit(fullMethod string, perSecond int) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if perSecond <= 0 {
+		delete(s.rateLimits, fullMethod)
+		return
+	}
+	if s.rateLimits == nil {
+		s.rateLimits = make(map[string]*rateLimiter)
+	}
+	s.rateLimits[fullMethod] = &rateLimiter{
+		perSecond: float64(perSecond),
+		tokens:    float64(perSecond),
+		last:      s.Config.clock().now(),
+	}
+}
+
+// checkRateLimit returns a [codes.ResourceExhausted] error if the rate limit of fullMethod is exceeded.
+func (s *Server) checkRateLimit(fullMethod string) error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	limiter, ok := s.rateLimits[fullMethod]
+	if !ok || limiter.allow(s.Config.clock().now()) {
+		return nil
+	}
+	return status.Errorf(codes.ResourceExhausted, "grpctest: rate limit exceeded for %s", fullMethod)
+}
+
+// rateLimiter is a token bucket refilled at perSecond tokens per second.
+type rateLimiter struct {
+	perSecond float64
+	tokens    float64
+	last      time.Time
+}
+
+// allow reports whether a call is allowed at the given time, consuming a token if so.
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.tokens = min(l.perSecond, l.tokens+now.Sub(l.last).Seconds()*l.perSecond)
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// SetResponseTransformer sets a function called with the response of each successful unary RPC,
+// whose result is sent to the client instead. The transformer may modify the response in place
+// or return another message of the same type. Passing nil removes the transformer.
+//
+// This is useful to simulate a misbehaving server (e.g., a truncated field) and test
+// the client-side validation of responses.
+func (s *Server) SetResponseTransformer(transform func(fullMethod string, resp any) any) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.transformer = transform
+}
+
+// transformResponse applies the response transformer, if any, to resp.
+func (s *Server) transformResponse(fullMethod string, resp any) any {
+	s.stateMu.Lock()
+	transform := s.transformer
+	s.stateMu.Unlock()
+
+	if transform == nil {
+		return resp
+	}
+	return transform(fullMethod, resp)
+}
+
+// LoadResponses sets canned responses, keyed by full method (e.g., "/hello.Greeter/SayHello"),
+// which are sent to the client instead of calling the handler of unary RPCs.
+// Responses must be of the output type of their method. Each call receives its own copy.
+// Loading a response for a method replaces the previous one, if any, and [Server.Reset] removes
+// all of them. Streaming RPCs are not affected.
+//
+// This enables a record/replay workflow, where responses recorded from a real server
+// (e.g., stored in a fixture file) drive deterministic client tests.
+func (s *Server) LoadResponses(responses map[string]proto.Message) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.responses == nil {
+		s.responses = make(map[string]proto.Message, len(responses))
+	}
+	for fullMethod, resp := range responses {
+		s.responses[fullMethod] = proto.Clone(resp)
+	}
+}
+
+// cannedResponse returns a copy of the canned response loaded for fullMethod, if any.
+func (s *Server) cannedResponse(fullMethod string) (proto.Message, bool) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	resp, ok := s.responses[fullMethod]
+	if !ok {
+		return nil, false
+	}
+	return proto.Clone(resp), true
+}
+
+// Blackhole makes the given full method (e.g., "/hello.Greeter/SayHello") never respond:
+// calls block until their context is done, then fail with [codes.Canceled].
+// The handler is never called. [Server.Reset] removes all the blackholes.
+//
+// This models an unresponsive upstream, to test client deadlines without sleeping an arbitrary duration.
+func (s *Server) Blackhole(fullMethod string) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.blackholes == nil {
+		s.blackholes = make(map[string]bool)
+	}
+	s.blackholes[fullMethod] = true
+}
+
+// waitIfBlackholed blocks until ctx is done if fullMethod is blackholed.
+func (s *Server) waitIfBlackholed(ctx context.Context, fullMethod string) error {
+	s.stateMu.Lock()
+	blackholed := s.blackholes[fullMethod]
+	s.stateMu.Unlock()
+
+	if !blackholed {
+		return nil
+	}
+	<-ctx.Done()
+	return status.Errorf(codes.Canceled, "grpctest: %s is blackholed", fullMethod)
+}
+
+// RequireMetadata makes the server reject any RPC whose incoming metadata lacks the given key
+// with the given status code (e.g., [codes.Unauthenticated] for "authorization").
+// Keys are case-insensitive. [Server.Reset] removes all the requirements.
+//
+// This verifies that clients attach required headers, without writing the interceptor.
+func (s *Server) RequireMetadata(key string, code codes.Code) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.requiredMD == nil {
+		s.requiredMD = make(map[string]codes.Code)
+	}
+	s.requiredMD[strings.ToLower(key)] = code
+}
+
+// checkRequiredMetadata returns an error if the incoming metadata of ctx lacks a required key.
+func (s *Server) checkRequiredMetadata(ctx context.Context) error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if len(s.requiredMD) == 0 {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	// Sorted for a deterministic error when several keys are missing
+	for _, key := range slices.Sorted(maps.Keys(s.requiredMD)) {
+		if len(md.Get(key)) == 0 {
+			return status.Errorf(s.requiredMD[key], "grpctest: missing required metadata %q", key)
+		}
+	}
+	return nil
+}
+
+// InjectErrorWithDetails makes calls to the given full method (e.g., "/hello.Greeter/SayHello")
+// fail with st enriched with the given details (e.g., *errdetails.BadRequest), without calling the handler.
+// This exercises the client's status.Convert(err).Details() path deterministically.
+// Passing a nil st removes the injected error. [Server.Reset] removes all the injected errors.
+//
+// It panics if the details cannot be added to st (e.g., st has the code OK).
+func (s *Server) InjectErrorWithDetails(fullMethod string, st *status.Status, details ...proto.Message) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if st == nil {
+		delete(s.injectedErrs, fullMethod)
+		return
+	}
+
+	v1Details := make([]protoadapt.MessageV1, len(details))
+	for i, detail := range details {
+		v1Details[i] = protoadapt.MessageV1Of(detail)
+	}
+	st, err := st.WithDetails(v1Details...)
+	if err != nil {
+		panic(fmt.Sprintf("grpctest: failed to add error details: %v", err))
+	}
+
+	if s.injectedErrs == nil {
+		s.injectedErrs = make(map[string]error)
+	}
+	s.injectedErrs[fullMethod] = st.Err()
+}
+
+// injectedError returns the error injected for fullMethod, if any.
+func (s *Server) injectedError(fullMethod string) error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.injectedErrs[fullMethod]
+}
+
+// streamError is an error injected on the streams of a method, after some messages were sent.
+type streamError struct {
+	afterN int
+	err    error
+}
+
+// InjectStreamError makes the streams of the given full method (e.g., "/hello.Greeter/SayHelloStream")
+// fail with the given code once the handler has sent afterN messages: the next send fails, and the
+// stream ends with the injected status whatever the handler returns. This models a backend failing
+// midway through a stream, to verify the client's handling of partial results followed by an error.
+// Passing [codes.OK] removes the injected error. [Server.Reset] removes all the injected errors.
+//
+// Note: handlers sending at most afterN messages are not affected.
+func (s *Server) InjectStreamError(fullMethod string, afterN int, code codes.Code) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if code == codes.OK {
+		delete(s.streamErrs, fullMethod)
+		return
+	}
+	if s.streamErrs == nil {
+		s.streamErrs = make(map[string]streamError)
+	}
+	s.streamErrs[fullMethod] = streamError{
+		afterN: max(afterN, 0),
+		err:    status.Errorf(code, "grpctest: injected error after %d messages", max(afterN, 0)),
+	}
+}
+
+// injectStreamError wraps handler to fail the stream as injected for fullMethod, if any.
+func (s *Server) injectStreamError(fullMethod string, handler grpc.StreamHandler) grpc.StreamHandler {
+	s.stateMu.Lock()
+	injected, ok := s.streamErrs[fullMethod]
+	s.stateMu.Unlock()
+
+	if !ok {
+		return handler
+	}
+	return func(srv any, ss grpc.ServerStream) error {
+		stream := &failingStream{ServerStream: ss, injected: injected}
+		err := handler(srv, stream)
+		if stream.failed {
+			return injected.err
+		}
+		return err
+	}
+}
+
+// failingStream wraps a [grpc.ServerStream] to fail the sends beyond the limit of an injected error.
+type failingStream struct {
+	grpc.ServerStream
+	injected streamError
+	sent     int
+	failed   bool
+}
+
+// SendMsg sends m, unless the limit of messages is reached.
+func (s *failingStream) SendMsg(m any) error {
+	if s.sent >= s.injected.afterN {
+		s.failed = true
+		return s.injected.err
+	}
+	s.sent++
+	return s.ServerStream.SendMsg(m)
+}
+
+// Salts mixed into the seed of each random injection feature, so that features seeded alike
+// (e.g., with [WithRandSeed]) draw independent sequences instead of correlated ones.
+const (
+	flakinessSalt int64 = 0x1f3a_5c7e_9b2d_4e6f
+	jitterSalt    int64 = 0x6b8d_2f41_a7c3_e590
+)
+
+// newRand returns a random number generator seeded with seed mixed with salt.
+func newRand(seed, salt int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed ^ salt)) // nolint:gosec // reproducible sequences
+}
+
+// flakiness makes RPCs fail randomly.
+type flakiness struct {
+	p    float64
+	code codes.Code
+	seed int64
+	rng  *rand.Rand
+}
+
+// SetFlakiness makes each RPC fail with the given code with probability p, using a random number
+// generator seeded with the seed set by [WithRandSeed] (or a random seed otherwise). The seed is
+// included in the error message, so that a failing run can be reproduced.
+// This enables statistical tests of client retry success rates.
+// A p lower than or equal to 0 removes the flakiness, and [Server.Reset] removes it as well.
+//
+// Note: the outcome of concurrent RPCs depends on the order in which they are received.
+func (s *Server) SetFlakiness(p float64, code codes.Code) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if p <= 0 {
+		s.flakiness = nil
+		return
+	}
+	seed := time.Now().UnixNano()
+	if s.Config.randSeed != nil {
+		seed = *s.Config.randSeed
+	}
+	s.flakiness = &flakiness{
+		p:    p,
+		code: code,
+		seed: seed,
+		rng:  newRand(seed, flakinessSalt),
+	}
+}
+
+// checkFlakiness randomly fails the RPC according to the flakiness, if any.
+func (s *Server) checkFlakiness() error {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	f := s.flakiness
+	if f == nil || f.rng.Float64() >= f.p {
+		return nil
+	}
+	return status.Errorf(f.code, "grpctest: flaky failure (seed %d)", f.seed)
+}
+
+// jitter delays RPCs randomly.
+type jitter struct {
+	base   time.Duration
+	spread time.Duration
+	rng    *rand.Rand
+}
+
+// InjectJitter delays each RPC by base plus or minus a random duration up to spread, using a random
+// number generator seeded with the seed set by [WithRandSeed] (or a random seed otherwise), so that
+// the delays are reproducible. The delay is never negative, and it elapses on the clock set with [WithClock].
+// This produces more realistic latency distributions than a constant delay, for client timeout
+// or percentile tests.
+// Zero durations remove the jitter, and [Server.Reset] removes it as well.
+//
+// Note: the delay is not interrupted when the client cancels the RPC.
+func (s *Server) InjectJitter(base, spread time.Duration) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if base <= 0 && spread <= 0 {
+		s.jitter = nil
+		return
+	}
+	seed := time.Now().UnixNano()
+	if s.Config.randSeed != nil {
+		seed = *s.Config.randSeed
+	}
+	s.jitter = &jitter{
+		base:   base,
+		spread: max(spread, 0),
+		rng:    newRand(seed, jitterSalt),
+	}
+}
+
+// InjectUncancellableLatency delays each RPC by d before it reaches the handler, ignoring
+// the cancellation of the RPC by the client, like real backends which don't honor cancellation.
+// This allows to test that client deadlines still fire client-side when the server ignores them.
+// The delay elapses on the clock set with [WithClock], and adds up to the jitter (see [Server.InjectJitter]).
+// A zero duration removes the latency, and [Server.Reset] removes it as well.
+func (s *Server) InjectUncancellableLatency(d time.Duration) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.latency = max(d, 0)
+}
+
+// injectDelay delays the RPC according to the injected latency and jitter, if any.
+func (s *Server) injectDelay() {
+	s.stateMu.Lock()
+	delay := s.latency
+	if j := s.jitter; j != nil {
+		delay += max(j.base+time.Duration((2*j.rng.Float64()-1)*float64(j.spread)), 0)
+	}
+	s.stateMu.Unlock()
+
+	if delay > 0 {
+		s.Config.clock().sleep(delay)
+	}
+}
+
+// SetMaxRequestSize makes the server reject the request messages of fullMethod larger than
+// the given number of bytes with [codes.ResourceExhausted], for both unary and streaming RPCs.
+// This allows per-method payload-limit tests, which the global limit set with
+// [WithMaxRecvMsgSize] can't express.
+// A zero or negative size removes the limit, and [Server.Reset] removes all the limits.
+//
+// Note: the size of a message is its serialized size, computed once it is received.
+func (s *Server) SetMaxRequestSize(fullMethod string, bytes int) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if bytes <= 0 {
+		delete(s.maxReqSizes, fullMethod)
+		return
+	}
+	if s.maxReqSizes == nil {
+		s.maxReqSizes = make(map[string]int)
+	}
+	s.maxReqSizes[fullMethod] = bytes
+}
+
+// maxRequestSize returns the maximum request size set for fullMethod, if any.
+func (s *Server) maxRequestSize(fullMethod string) (int, bool) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	limit, ok := s.maxReqSizes[fullMethod]
+	return limit, ok
+}
+
+// checkRequestSize returns a ResourceExhausted error if req is larger than the maximum size set for fullMethod.
+func (s *Server) checkRequestSize(fullMethod string, req any) error {
+	limit, ok := s.maxRequestSize(fullMethod)
+	if !ok {
+		return nil
+	}
+	return checkMessageSize(req, limit)
+}
+
+// checkMessageSize returns a ResourceExhausted error if m is a protobuf message larger than limit.
+func checkMessageSize(m any, limit int) error {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return nil
+	}
+	if size := proto.Size(msg); size > limit {
+		return status.Errorf(codes.ResourceExhausted, "grpctest: request message of %d bytes exceeds the limit of %d bytes", size, limit)
+	}
+	return nil
+}
+
+// limitRequestSize wraps ss to reject the request messages larger than the maximum size set
+// for fullMethod, if any.
+func (s *Server) limitRequestSize(ss grpc.ServerStream, fullMethod string) grpc.ServerStream {
+	limit, ok := s.maxRequestSize(fullMethod)
+	if !ok {
+		return ss
+	}
+	return &limitedStream{ServerStream: ss, limit: limit}
+}
+
+// limitedStream wraps a [grpc.ServerStream] to reject the request messages larger than limit.
+type limitedStream struct {
+	grpc.ServerStream
+	limit int
+}
+
+// RecvMsg receives m, failing if it is larger than the limit.
+func (s *limitedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return checkMessageSize(m, s.limit)
+}
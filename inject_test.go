@@ -0,0 +1,698 @@
+package grpctest_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPauseResume(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	server.Pause()
+
+	t.Run("blocked call respects context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("expected DeadlineExceeded, got %v", err)
+		}
+	})
+
+	t.Run("blocked call is released on resume", func(t *testing.T) {
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+			errCh <- err
+		}()
+
+		select {
+		case err := <-errCh:
+			t.Fatalf("expected call to block while paused, got %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		server.Resume()
+		if err := <-errCh; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestPauseThenClose(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	// Use a connection not managed by the server: those are closed by Close
+	conn, err := grpc.NewClient(server.URL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	client := pb.NewGreeterClient(conn)
+	server.Pause()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+		errCh <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	server.Close()
+	if err := <-errCh; status.Code(err) != codes.Unavailable {
+		t.Errorf("expected Unavailable, got %v", err)
+	}
+}
+
+func TestSetHeaderAndTrailerForMethod(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	server.SetHeaderForMethod("/hello.Greeter/SayHello", metadata.Pairs("x-request-id", "42"))
+	server.SetTrailerForMethod("/hello.Greeter/SayHello", metadata.Pairs("x-ratelimit-remaining", "0"))
+	server.SetTrailerForMethod("/hello.Greeter/SayHelloStream", metadata.Pairs("x-stream", "done"))
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx := context.Background()
+
+	t.Run("unary", func(t *testing.T) {
+		var header, trailer metadata.MD
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}, grpc.Header(&header), grpc.Trailer(&trailer)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := header.Get("x-request-id"); len(got) != 1 || got[0] != "42" {
+			t.Errorf("expected header x-request-id=42, got %v", got)
+		}
+		if got := trailer.Get("x-ratelimit-remaining"); len(got) != 1 || got[0] != "0" {
+			t.Errorf("expected trailer x-ratelimit-remaining=0, got %v", got)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		stream, err := client.SayHelloStream(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := stream.Send(&pb.HelloRequest{Name: "World"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := stream.Recv(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := stream.Recv(); err != io.EOF {
+			t.Fatalf("expected EOF, got %v", err)
+		}
+		if got := stream.Trailer().Get("x-stream"); len(got) != 1 || got[0] != "done" {
+			t.Errorf("expected trailer x-stream=done, got %v", got)
+		}
+	})
+}
+
+func TestSetRateLimit(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	server.SetRateLimit("/hello.Greeter/SayHello", 2)
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx := context.Background()
+
+	// The burst allows 2 calls, then calls are rejected
+	for i := range 2 {
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+			t.Fatalf("call %d: unexpected error: %v", i, err)
+		}
+	}
+	_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+
+	// Tokens are refilled over time
+	time.Sleep(600 * time.Millisecond)
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error after refill: %v", err)
+	}
+
+	// Removing the limit
+	server.SetRateLimit("/hello.Greeter/SayHello", 0)
+	for i := range 5 {
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+			t.Fatalf("call %d: unexpected error without limit: %v", i, err)
+		}
+	}
+}
+
+func TestWithMetadataEcho(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithMetadataEcho())
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx := grpctest.OutgoingContext(context.Background(), "authorization", "Bearer token", "x-tenant", "acme")
+
+	t.Run("unary", func(t *testing.T) {
+		var trailer metadata.MD
+		if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}, grpc.Trailer(&trailer)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := trailer.Get(grpctest.MetadataEchoPrefix + "authorization"); len(got) != 1 || got[0] != "Bearer token" {
+			t.Errorf("expected echoed authorization, got %v", got)
+		}
+		if got := trailer.Get(grpctest.MetadataEchoPrefix + "x-tenant"); len(got) != 1 || got[0] != "acme" {
+			t.Errorf("expected echoed x-tenant, got %v", got)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		stream, err := client.SayHelloStream(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := stream.Send(&pb.HelloRequest{Name: "World"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for {
+			if _, err := stream.Recv(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if got := stream.Trailer().Get(grpctest.MetadataEchoPrefix + "x-tenant"); len(got) != 1 || got[0] != "acme" {
+			t.Errorf("expected echoed x-tenant, got %v", got)
+		}
+	})
+}
+
+func TestSetResponseTransformer(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	var gotMethod string
+	server.SetResponseTransformer(func(fullMethod string, resp any) any {
+		gotMethod = fullMethod
+		reply := resp.(*pb.HelloReply)
+		reply.Message = reply.Message[:5]
+		return reply
+	})
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	reply, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reply.Message != "Hello" {
+		t.Errorf("expected truncated message, got %q", reply.Message)
+	}
+	if gotMethod != "/hello.Greeter/SayHello" {
+		t.Errorf("unexpected full method: %q", gotMethod)
+	}
+
+	server.SetResponseTransformer(nil)
+	reply, err = client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reply.Message != "Hello World" {
+		t.Errorf("expected original message after removing the transformer, got %q", reply.Message)
+	}
+}
+
+func TestLoadResponses(t *testing.T) {
+	var called atomic.Bool
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				called.Store(true)
+				return &pb.HelloReply{Message: "Hello " + req.Name}, nil
+			},
+		})
+	})
+	defer server.Close()
+
+	canned := &pb.HelloReply{Message: "recorded"}
+	server.LoadResponses(map[string]proto.Message{
+		"/hello.Greeter/SayHello": canned,
+	})
+	// The server keeps its own copy
+	canned.Message = "modified"
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	for range 2 {
+		reply, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reply.Message != "recorded" {
+			t.Errorf("expected the canned response, got %q", reply.Message)
+		}
+	}
+	if called.Load() {
+		t.Error("expected the handler not to be called")
+	}
+
+	server.Reset()
+	reply, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reply.Message != "Hello World" {
+		t.Errorf("expected the handler's response after reset, got %q", reply.Message)
+	}
+}
+
+func TestBlackhole(t *testing.T) {
+	var called atomic.Bool
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				called.Store(true)
+				return &pb.HelloReply{}, nil
+			},
+		})
+	})
+	defer server.Close()
+
+	server.Blackhole("/hello.Greeter/SayHello")
+	client := pb.NewGreeterClient(server.ClientConn())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected call to hang until the deadline, returned after %v", elapsed)
+	}
+	if called.Load() {
+		t.Error("expected handler not to be called")
+	}
+
+	server.Reset()
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error after Reset: %v", err)
+	}
+}
+
+func TestRequireMetadata(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	server.RequireMetadata("Authorization", codes.Unauthenticated)
+	client := pb.NewGreeterClient(server.ClientConn())
+
+	_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated without metadata, got %v", err)
+	}
+
+	ctx := grpctest.OutgoingContext(context.Background(), "authorization", "Bearer token")
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error with metadata: %v", err)
+	}
+
+	server.Reset()
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error after Reset: %v", err)
+	}
+}
+
+func TestInjectErrorWithDetails(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	badRequest := &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "name", Description: "too short"}},
+	}
+	server.InjectErrorWithDetails("/hello.Greeter/SayHello", status.New(codes.InvalidArgument, "invalid name"), badRequest)
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument || st.Message() != "invalid name" {
+		t.Fatalf("expected injected status, got %v", err)
+	}
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("expected 1 detail, got %d", len(details))
+	}
+	got, ok := details[0].(*errdetails.BadRequest)
+	if !ok || !proto.Equal(got, badRequest) {
+		t.Errorf("expected %v, got %v", badRequest, details[0])
+	}
+
+	server.InjectErrorWithDetails("/hello.Greeter/SayHello", nil)
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error after removing the injected error: %v", err)
+	}
+}
+
+func TestInjectErrorWithDetailsOK(t *testing.T) {
+	server := grpctest.NewUnstartedServer(nil)
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for a status with code OK")
+		}
+	}()
+	server.InjectErrorWithDetails("/hello.Greeter/SayHello", status.New(codes.OK, ""), &errdetails.ErrorInfo{})
+}
+
+func TestInjectStreamError(t *testing.T) {
+	const messages = 5
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloStreamHandler: func(stream pb.Greeter_SayHelloStreamServer) error {
+				for i := range messages {
+					// Send errors are ignored: the injected status is returned anyway
+					stream.Send(&pb.HelloReply{Message: fmt.Sprint(i)}) // nolint:errcheck
+				}
+				return nil
+			},
+		})
+	})
+	defer server.Close()
+
+	const method = "/hello.Greeter/SayHelloStream"
+	client := pb.NewGreeterClient(server.ClientConn())
+	collect := func() ([]*pb.HelloReply, error) {
+		t.Helper()
+		stream, err := client.SayHelloStream(context.Background())
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		return grpctest.CollectStream(stream.Recv)
+	}
+
+	server.InjectStreamError(method, 2, codes.DeadlineExceeded)
+	replies, err := collect()
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if len(replies) != 2 {
+		t.Errorf("expected 2 replies before the error, got %d", len(replies))
+	}
+
+	server.InjectStreamError(method, 0, codes.OK)
+	replies, err = collect()
+	if err != nil {
+		t.Errorf("unexpected error once the injected error is removed: %v", err)
+	}
+	if len(replies) != messages {
+		t.Errorf("expected %d replies, got %d", messages, len(replies))
+	}
+}
+
+func TestSetFlakiness(t *testing.T) {
+	const calls = 50
+	outcomes := func() []codes.Code {
+		t.Helper()
+		server := grpctest.NewServer(func(s *grpc.Server) {
+			pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+		}, grpctest.WithRandSeed(42))
+		defer server.Close()
+
+		server.SetFlakiness(0.5, codes.Unavailable)
+		client := pb.NewGreeterClient(server.ClientConn())
+		var got []codes.Code
+		for range calls {
+			_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "flaky"})
+			got = append(got, status.Code(err))
+		}
+		return got
+	}
+
+	first, second := outcomes(), outcomes()
+	var failures int
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same outcomes with the same seed, got %v and %v", first, second)
+		}
+		if first[i] == codes.Unavailable {
+			failures++
+		}
+	}
+	if failures == 0 || failures == calls {
+		t.Errorf("expected some calls to fail and some to succeed, got %d failures out of %d", failures, calls)
+	}
+
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+	client := pb.NewGreeterClient(server.ClientConn())
+
+	server.SetFlakiness(1, codes.Internal)
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "flaky"}); status.Code(err) != codes.Internal {
+		t.Errorf("expected Internal with a probability of 1, got %v", err)
+	}
+
+	server.SetFlakiness(0, codes.Internal)
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "flaky"}); err != nil {
+		t.Errorf("unexpected error once the flakiness is removed: %v", err)
+	}
+}
+
+func TestInjectJitter(t *testing.T) {
+	const (
+		calls  = 20
+		base   = 100 * time.Millisecond
+		spread = 50 * time.Millisecond
+	)
+	delays := func() []time.Duration {
+		t.Helper()
+		var (
+			mu    sync.Mutex
+			slept []time.Duration
+		)
+		sleep := func(d time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			slept = append(slept, d)
+		}
+		server := grpctest.NewServer(func(s *grpc.Server) {
+			pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+		}, grpctest.WithRandSeed(42), grpctest.WithClock(time.Now, sleep))
+		defer server.Close()
+
+		server.InjectJitter(base, spread)
+		client := pb.NewGreeterClient(server.ClientConn())
+		for range calls {
+			if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "jitter"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		server.InjectJitter(0, 0)
+		if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "jitter"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		return slept
+	}
+
+	first, second := delays(), delays()
+	if !slices.Equal(first, second) {
+		t.Fatalf("expected the same delays with the same seed, got %v and %v", first, second)
+	}
+	if len(first) != calls {
+		t.Fatalf("expected %d delays (none once the jitter is removed), got %d", calls, len(first))
+	}
+	for _, d := range first {
+		if d < base-spread || d > base+spread {
+			t.Errorf("expected a delay within %v ± %v, got %v", base, spread, d)
+		}
+	}
+	if slices.Min(first) == slices.Max(first) {
+		t.Errorf("expected varying delays, got %v", first)
+	}
+}
+
+func TestInjectJitterWithFlakiness(t *testing.T) {
+	const (
+		calls  = 200
+		base   = 100 * time.Millisecond
+		spread = 100 * time.Millisecond
+	)
+	var (
+		mu    sync.Mutex
+		slept []time.Duration
+	)
+	sleep := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		slept = append(slept, d)
+	}
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithRandSeed(7), grpctest.WithClock(time.Now, sleep))
+	defer server.Close()
+
+	server.InjectJitter(base, spread)
+	server.SetFlakiness(0.3, codes.Unavailable)
+	client := pb.NewGreeterClient(server.ClientConn())
+	var failed, succeeded []time.Duration
+	for i := range calls {
+		_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "jitter"})
+		mu.Lock()
+		delay := slept[i]
+		mu.Unlock()
+		if status.Code(err) == codes.Unavailable {
+			failed = append(failed, delay)
+		} else {
+			succeeded = append(succeeded, delay)
+		}
+	}
+	if len(failed) == 0 || len(succeeded) == 0 {
+		t.Fatalf("expected some calls to fail and some to succeed, got %d failures out of %d", len(failed), calls)
+	}
+
+	// With the same seed, the delays must not predict the failures
+	if slices.Max(failed) < slices.Min(succeeded) {
+		t.Errorf("expected the delays of failed and successful calls to overlap, failed ones are all below %v", slices.Min(succeeded))
+	}
+	var total time.Duration
+	for _, d := range failed {
+		total += d
+	}
+	if mean := total / time.Duration(len(failed)); mean < base*3/4 || mean > base*5/4 {
+		t.Errorf("expected the mean delay of failed calls to be about %v, got %v", base, mean)
+	}
+}
+
+func TestInjectUncancellableLatency(t *testing.T) {
+	const latency = 300 * time.Millisecond
+	handled := make(chan time.Time, 1)
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				handled <- time.Now()
+				return &pb.HelloReply{Message: "Hello " + req.Name}, nil
+			},
+		})
+	})
+	defer server.Close()
+
+	server.InjectUncancellableLatency(latency)
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= latency {
+		t.Errorf("expected the deadline to fire client-side before %v, got %v", latency, elapsed)
+	}
+
+	// The server ignores the cancellation and calls the handler once the latency elapsed
+	select {
+	case at := <-handled:
+		if elapsed := at.Sub(start); elapsed < latency {
+			t.Errorf("expected the handler to be called after %v, got %v", latency, elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the handler")
+	}
+
+	server.InjectUncancellableLatency(0)
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error once the latency is removed: %v", err)
+	}
+}
+
+func TestSetMaxRequestSize(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	const limit = 64
+	small := &pb.HelloRequest{Name: "World"}
+	large := &pb.HelloRequest{Name: strings.Repeat("x", limit)}
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx := context.Background()
+
+	server.SetMaxRequestSize("/hello.Greeter/SayHello", limit)
+	server.SetMaxRequestSize("/hello.Greeter/SayHelloClientStream", limit)
+	if _, err := client.SayHello(ctx, small); err != nil {
+		t.Errorf("unexpected error for a small request: %v", err)
+	}
+	if _, err := client.SayHello(ctx, large); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted for a large request, got %v", err)
+	}
+
+	sendAll := func(reqs ...*pb.HelloRequest) error {
+		t.Helper()
+		stream, err := server.GreeterClientStream(ctx)
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		for _, req := range reqs {
+			if err := stream.Send(req); err != nil {
+				break // the error is returned by CloseAndRecv
+			}
+		}
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	if err := sendAll(small, small); err != nil {
+		t.Errorf("unexpected error for small messages: %v", err)
+	}
+	if err := sendAll(small, large); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted for a large message, got %v", err)
+	}
+	// The rejected message is not counted as received
+	if recv, _ := server.StreamStats("/hello.Greeter/SayHelloClientStream"); recv != 1 {
+		t.Errorf("expected 1 message received before the large one, got %d", recv)
+	}
+
+	// Limits are removed per method, or all at once by Reset
+	server.SetMaxRequestSize("/hello.Greeter/SayHello", 0)
+	if _, err := client.SayHello(ctx, large); err != nil {
+		t.Errorf("unexpected error once the limit is removed: %v", err)
+	}
+	server.Reset()
+	if err := sendAll(large); err != nil {
+		t.Errorf("unexpected error after reset: %v", err)
+	}
+}
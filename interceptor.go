@@ -0,0 +1,234 @@
+package grpctest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// testLogger logs through tb until the test completes: RPCs completing afterwards (e.g., drained
+// by [Server.Close]) must not log, since testing panics on logs after the test has completed.
+type testLogger struct {
+	tb   testing.TB
+	mu   sync.Mutex
+	done bool
+}
+
+// newTestLogger returns a logger through tb, disabled when the test completes.
+func newTestLogger(tb testing.TB) *testLogger {
+	l := &testLogger{tb: tb}
+	tb.Cleanup(func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.done = true
+	})
+	return l
+}
+
+// logf formats and logs its arguments through tb, unless the test has completed.
+func (l *testLogger) logf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.done {
+		l.tb.Logf(format, args...)
+	}
+}
+
+// loggingUnaryInterceptor logs the method, duration and resulting code of each unary RPC through l.
+// Durations are measured with the clock of c.
+func loggingUnaryInterceptor(l *testLogger, c *ServerConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		clk := c.clock()
+		start := clk.now()
+		resp, err := handler(ctx, req)
+		l.logf("grpctest: unary %s %s (%v)", info.FullMethod, status.Code(err), clk.since(start))
+		return resp, err
+	}
+}
+
+// loggingStreamInterceptor logs the method, duration and resulting code of each streaming RPC through l.
+// Durations are measured with the clock of c.
+func loggingStreamInterceptor(l *testLogger, c *ServerConfig) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		clk := c.clock()
+		start := clk.now()
+		err := handler(srv, ss)
+		l.logf("grpctest: stream %s %s (%v)", info.FullMethod, status.Code(err), clk.since(start))
+		return err
+	}
+}
+
+// contextValuesUnaryInterceptor adds the given key/value pairs to the context of each unary RPC.
+func contextValuesUnaryInterceptor(pairs map[any]any) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(withValues(ctx, pairs), req)
+	}
+}
+
+// contextValuesStreamInterceptor adds the given key/value pairs to the context of each streaming RPC.
+func contextValuesStreamInterceptor(pairs map[any]any) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: withValues(ss.Context(), pairs)})
+	}
+}
+
+// withValues returns a copy of ctx carrying the given key/value pairs.
+func withValues(ctx context.Context, pairs map[any]any) context.Context {
+	for key, value := range pairs {
+		ctx = context.WithValue(ctx, key, value)
+	}
+	return ctx
+}
+
+// serverStream wraps a [grpc.ServerStream] to override its context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the overridden context of the stream.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// shuffleHandler wraps handler to buffer the messages it sends, then send them in an order
+// determined by seed once it returns.
+func shuffleHandler(handler grpc.StreamHandler, seed int64) grpc.StreamHandler {
+	return func(srv any, ss grpc.ServerStream) error {
+		stream := &bufferingStream{ServerStream: ss}
+		err := handler(srv, stream)
+
+		msgs := stream.msgs
+		rand.New(rand.NewSource(seed)).Shuffle(len(msgs), func(i, j int) { // nolint:gosec // reproducible order
+			msgs[i], msgs[j] = msgs[j], msgs[i]
+		})
+		for _, m := range msgs {
+			if sendErr := ss.SendMsg(m); sendErr != nil {
+				return errors.Join(err, sendErr)
+			}
+		}
+		return err
+	}
+}
+
+// bufferingStream wraps a [grpc.ServerStream] to buffer the messages sent instead of sending them.
+type bufferingStream struct {
+	grpc.ServerStream
+	msgs []any
+}
+
+// SendMsg buffers a copy of m, as handlers may reuse the message once sent.
+func (s *bufferingStream) SendMsg(m any) error {
+	if msg, ok := m.(proto.Message); ok {
+		m = proto.Clone(msg)
+	}
+	s.msgs = append(s.msgs, m)
+	return nil
+}
+
+// unknownMethodHandler returns a handler failing calls to unknown methods with the given code.
+func unknownMethodHandler(code codes.Code) grpc.StreamHandler {
+	return func(srv any, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		return status.Errorf(code, "grpctest: unknown method %s", method)
+	}
+}
+
+// unaryInterceptor is the server's own unary interceptor.
+// It is installed on every server to implement the capture and injection features.
+func (s *Server) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	s.capture(ctx)
+	s.countCall(info.FullMethod)
+	defer func() { s.record(info.FullMethod, req, resp, err) }()
+	if err := s.admit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	defer s.inFlight.Done()
+	if err := s.checkRequestSize(info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	if err := s.setUnaryMetadata(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	if canned, ok := s.cannedResponse(info.FullMethod); ok {
+		handler = func(context.Context, any) (any, error) { return canned, nil }
+	}
+	start := s.Config.clock().now()
+	resp, err = handler(ctx, req)
+	s.recordTiming(info.FullMethod, start)
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	return s.transformResponse(info.FullMethod, resp), nil
+}
+
+// streamInterceptor is the server's own stream interceptor.
+// It is installed on every server to implement the capture and injection features.
+func (s *Server) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	s.capture(ss.Context())
+	s.countCall(info.FullMethod)
+	defer func() { s.record(info.FullMethod, nil, nil, err) }()
+	defer s.trackStream(info.FullMethod)()
+	if err := s.admit(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	defer s.inFlight.Done()
+	if err := s.setStreamMetadata(ss, info.FullMethod); err != nil {
+		return err
+	}
+	// Messages rejected by the size limit are not counted
+	ss = s.limitRequestSize(ss, info.FullMethod)
+	ss = s.countMessages(ss, info.FullMethod)
+	handler = s.injectStreamError(info.FullMethod, handler)
+	if seed := s.Config.streamShuffle; seed != nil {
+		handler = shuffleHandler(handler, *seed)
+	}
+	start := s.Config.clock().now()
+	err = handler(srv, ss)
+	s.recordTiming(info.FullMethod, start)
+	return s.mapError(err)
+}
+
+// mapError converts err with the error mapper, if any, unless err is nil or already a status.
+func (s *Server) mapError(err error) error {
+	if err == nil || s.Config.errorMapper == nil {
+		return err
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return s.Config.errorMapper(err)
+}
+
+// admit runs the injection checks shared by unary and streaming RPCs before calling the handler.
+// It returns the error to send to the client, if any. Otherwise, the RPC is counted as in flight
+// and the caller must call s.inFlight.Done once the RPC is done.
+func (s *Server) admit(ctx context.Context, fullMethod string) error {
+	if err := s.waitIfPaused(ctx); err != nil {
+		return err
+	}
+	s.injectDelay()
+	if err := s.checkRequiredMetadata(ctx); err != nil {
+		return err
+	}
+	if err := s.checkRateLimit(fullMethod); err != nil {
+		return err
+	}
+	if err := s.injectedError(fullMethod); err != nil {
+		return err
+	}
+	if err := s.checkFlakiness(); err != nil {
+		return err
+	}
+	if err := s.waitIfBlackholed(ctx, fullMethod); err != nil {
+		return err
+	}
+	return s.beginCall()
+}
@@ -0,0 +1,139 @@
+package grpctest
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// States of the connections reported to the hook set with [WithConnStateHook].
+const (
+	ConnAccepted = "accepted"
+	ConnClosed   = "closed"
+)
+
+// serverListener wraps a [net.Listener] to count the accepted connections, to pass them
+// to the raw connection inspector, if any, to report their lifecycle, and to simulate network partitions.
+type serverListener struct {
+	net.Listener
+	accepted  *atomic.Int64
+	inspect   func(net.Conn) net.Conn
+	stateHook func(addr net.Addr, state string)
+
+	mu          sync.Mutex
+	partitioned bool                  // whether new connections are rejected
+	conns       map[net.Conn]struct{} // open accepted connections
+}
+
+// Accept waits for and returns the next connection, counting it.
+// While partitioned, connections are closed as soon as they are accepted.
+func (l *serverListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		l.mu.Lock()
+		if l.partitioned {
+			l.mu.Unlock()
+			conn.Close() // nolint:errcheck
+			continue
+		}
+		if l.conns == nil {
+			l.conns = make(map[net.Conn]struct{})
+		}
+		tracked := &trackedConn{Conn: conn, listener: l}
+		l.conns[tracked] = struct{}{}
+		l.mu.Unlock()
+
+		l.accepted.Add(1)
+		l.reportState(conn, ConnAccepted)
+		if l.inspect != nil {
+			return l.inspect(tracked), nil
+		}
+		return tracked, nil
+	}
+}
+
+// reportState reports the state of conn to the state hook, if any.
+func (l *serverListener) reportState(conn net.Conn, state string) {
+	if l.stateHook != nil {
+		l.stateHook(conn.RemoteAddr(), state)
+	}
+}
+
+// partition closes the open connections and rejects the new ones until heal is called.
+func (l *serverListener) partition() {
+	l.mu.Lock()
+	l.partitioned = true
+	conns := l.conns
+	l.conns = nil
+	l.mu.Unlock()
+
+	for conn := range conns {
+		conn.Close() // nolint:errcheck
+	}
+}
+
+// heal accepts new connections again.
+func (l *serverListener) heal() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.partitioned = false
+}
+
+// trackedConn is a connection accepted by a [serverListener], forgotten once closed.
+type trackedConn struct {
+	net.Conn
+	listener *serverListener
+	closed   atomic.Bool
+}
+
+// Close closes the connection and removes it from the open connections of the listener.
+// The first call reports the connection as closed.
+func (c *trackedConn) Close() error {
+	c.listener.mu.Lock()
+	delete(c.listener.conns, c)
+	c.listener.mu.Unlock()
+	err := c.Conn.Close()
+	if c.closed.CompareAndSwap(false, true) {
+		c.listener.reportState(c.Conn, ConnClosed)
+	}
+	return err
+}
+
+// AcceptedConns returns the number of transport connections (e.g., TCP connections)
+// accepted by the server since it started. Connections to the admin server are not counted.
+//
+// This is useful to test connection pooling, e.g., that the cached client returned by
+// [Server.ClientConn] reuses a single connection while clients created with options
+// open distinct ones.
+func (s *Server) AcceptedConns() int {
+	return int(s.acceptedConns.Load())
+}
+
+// Partition simulates a network partition between the server and its clients: all the open
+// connections are dropped, and new connections are closed as soon as they are accepted,
+// until [Server.Heal] is called. The server itself keeps running.
+//
+// This models a network blip, to verify that clients recover once the network is healed.
+func (s *Server) Partition() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		s.listener.partition()
+	}
+}
+
+// Heal ends the network partition started by [Server.Partition]: new connections are accepted again.
+// Clients reconnect according to their connection backoff (see [WithClientConnectParams]).
+func (s *Server) Heal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		s.listener.heal()
+	}
+}
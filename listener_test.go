@@ -0,0 +1,123 @@
+package grpctest_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAcceptedConns(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []grpctest.Option
+	}{
+		{name: "tcp"},
+		{name: "bufconn", opts: []grpctest.Option{grpctest.WithBufconn()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := grpctest.NewServer(func(s *grpc.Server) {
+				pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+			}, tc.opts...)
+			defer server.Close()
+
+			if got := server.AcceptedConns(); got != 0 {
+				t.Fatalf("expected no connection before any call, got %d", got)
+			}
+
+			call := func(conn grpc.ClientConnInterface) {
+				if _, err := pb.NewGreeterClient(conn).SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			// The cached client reuses a single connection
+			for range 3 {
+				call(server.ClientConn())
+			}
+			if got := server.AcceptedConns(); got != 1 {
+				t.Errorf("expected 1 connection for the cached client, got %d", got)
+			}
+
+			// Clients created with options open distinct connections
+			call(server.ClientConn(grpc.WithUserAgent("first")))
+			call(server.ClientConn(grpc.WithUserAgent("second")))
+			if got := server.AcceptedConns(); got != 3 {
+				t.Errorf("expected 3 connections, got %d", got)
+			}
+		})
+	}
+}
+
+func TestPartition(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithClientConnectParams(grpc.ConnectParams{
+		Backoff:           backoff.Config{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond},
+		MinConnectTimeout: 100 * time.Millisecond,
+	}))
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	call := func(timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}, grpc.WaitForReady(true))
+		return err
+	}
+
+	if err := call(5 * time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server.Partition()
+	// Depending on whether the client noticed the dropped connection, the call fails
+	// on the dropped connection or waits for a new one until its deadline
+	if err := call(200 * time.Millisecond); status.Code(err) != codes.Unavailable && status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected the call to fail while partitioned, got %v", err)
+	}
+
+	server.Heal()
+	if err := call(5 * time.Second); err != nil {
+		t.Fatalf("expected the client to recover once healed, got %v", err)
+	}
+	if got := server.AcceptedConns(); got != 2 {
+		t.Errorf("expected 2 accepted connections, got %d", got)
+	}
+}
+
+func TestWithConnStateHook(t *testing.T) {
+	events := make(chan string, 10)
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	},
+		grpctest.WithMaxConnectionIdle(100*time.Millisecond),
+		grpctest.WithConnStateHook(func(addr net.Addr, state string) {
+			events <- state
+		}),
+	)
+	defer server.Close()
+
+	if _, err := pb.NewGreeterClient(server.ClientConn()).SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The idle connection is closed by the server
+	for _, want := range []string{grpctest.ConnAccepted, grpctest.ConnClosed} {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Errorf("expected state %q, got %q", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for state %q", want)
+		}
+	}
+}
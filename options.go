@@ -0,0 +1,472 @@
+package grpctest
+
+import (
+	"crypto/x509/pkix"
+	"io"
+	"maps"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Option configures a [Server].
+// Options are passed to the server constructors and applied to [Server.Config].
+type Option func(*ServerConfig)
+
+// WithCertRand sets the source of randomness used to generate the self-signed certificate
+// (private key and serial number). The private key is then an Ed25519 key derived from r,
+// instead of an ECDSA P-256 key, since ECDSA key generation and signatures are not deterministic.
+// Combined with [WithCertClock], the same reader produces byte-for-byte identical certificates,
+// which is useful for golden-file tests.
+//
+// Defaults to [crypto/rand.Reader].
+func WithCertRand(r io.Reader) Option {
+	return func(c *ServerConfig) {
+		c.certRand = r
+		c.requireTLS("WithCertRand")
+	}
+}
+
+// WithCertClock sets the clock used to compute the validity period of the self-signed certificate.
+// The certificate is valid from now() and for 24 hours.
+//
+// Defaults to the clock set by [WithClock], or [time.Now].
+func WithCertClock(now func() time.Time) Option {
+	return func(c *ServerConfig) {
+		c.certClock = now
+		c.requireTLS("WithCertClock")
+	}
+}
+
+// WithCertSubject sets the subject (e.g., CommonName, Organization) of the self-signed certificate,
+// which defaults to CN=localhost, O=grpctest. This is useful to test authorization based on the subject.
+//
+// The subject does not affect hostname verification: clients verify the certificate's SANs
+// ("localhost", 127.0.0.1 and ::1), so the client returned by [Server.ClientConn] keeps working
+// whatever the CommonName.
+func WithCertSubject(subject pkix.Name) Option {
+	return func(c *ServerConfig) {
+		c.certSubject = &subject
+		c.requireTLS("WithCertSubject")
+	}
+}
+
+// WithClock sets the time functions used by the server instead of [time.Now] and [time.Sleep]
+// (e.g., by rate limits, logging durations and certificate validity), so that time-based
+// features can be tested deterministically with a virtual clock.
+// The client returned by [Server.ClientConn] verifies the server's certificate with now too.
+// A nil function keeps the corresponding default.
+func WithClock(now func() time.Time, sleep func(time.Duration)) Option {
+	return func(c *ServerConfig) {
+		c.now = now
+		c.sleep = sleep
+	}
+}
+
+// WithGreeter registers greeter (e.g., a [GreeterServer]) on the server, in addition to the
+// services registered by the registration function, and makes it available to [Server.DirectClient].
+func WithGreeter(greeter pb.GreeterServer) Option {
+	return func(c *ServerConfig) {
+		c.greeter = greeter
+	}
+}
+
+// WithServerFactory sets the function used to create the gRPC server instead of [grpc.NewServer].
+// The factory receives the options computed by the test server (including its own interceptors),
+// which it must pass to [grpc.NewServer], possibly along with its own options.
+// This provides a single injection point for a customization shared by many test servers
+// (e.g., an interceptor chain used by the application).
+//
+// Example:
+//
+//	func newServer(opts ...grpc.ServerOption) *grpc.Server {
+//		return grpc.NewServer(append(opts, grpc.ChainUnaryInterceptor(appInterceptor))...)
+//	}
+//
+//	server := grpctest.NewServer(register, grpctest.WithServerFactory(newServer))
+func WithServerFactory(factory func(opts ...grpc.ServerOption) *grpc.Server) Option {
+	return func(c *ServerConfig) {
+		c.serverFactory = factory
+	}
+}
+
+// WithChannelz registers the channelz service on the server.
+// Paired with a tool such as grpcurl, it gives visibility into sockets and
+// subchannels while a test runs.
+func WithChannelz() Option {
+	return func(c *ServerConfig) {
+		c.channelz = true
+	}
+}
+
+// WithLogging logs the method, duration and resulting code of each RPC through tb.Logf.
+// Logs are only displayed when the test fails or when running with -v.
+// RPCs completing after the test (e.g., drained by [Server.Close]) are not logged.
+func WithLogging(tb testing.TB) Option {
+	return func(c *ServerConfig) {
+		logger := newTestLogger(tb)
+		c.unaryInterceptors = append(c.unaryInterceptors, loggingUnaryInterceptor(logger, c))
+		c.streamInterceptors = append(c.streamInterceptors, loggingStreamInterceptor(logger, c))
+	}
+}
+
+// WithContextValues adds the given key/value pairs to the context of each RPC before calling the handler.
+// This simulates the effect of upstream interceptors (e.g., an identity injected by an auth interceptor)
+// without running them.
+func WithContextValues(pairs map[any]any) Option {
+	pairs = maps.Clone(pairs)
+	return func(c *ServerConfig) {
+		c.unaryInterceptors = append(c.unaryInterceptors, contextValuesUnaryInterceptor(pairs))
+		c.streamInterceptors = append(c.streamInterceptors, contextValuesStreamInterceptor(pairs))
+	}
+}
+
+// WithReflection registers the server reflection service on the server,
+// allowing tools such as grpcurl to discover the registered services.
+func WithReflection() Option {
+	return func(c *ServerConfig) {
+		c.reflection = true
+	}
+}
+
+// WithMaxRecvMsgSize sets the maximum message size in bytes the server can receive.
+func WithMaxRecvMsgSize(n int) Option {
+	return func(c *ServerConfig) {
+		c.maxRecvMsgSize = n
+	}
+}
+
+// WithAdminServices starts a second gRPC server on its own random port to serve admin services
+// (e.g., health or metrics), mirroring deployments exposing business and admin RPCs on different ports.
+// The admin server address is available through [Server.AdminURL] and it uses the same
+// transport security as the main server. Both servers are shut down by [Server.Close].
+func WithAdminServices(registerFunc func(*grpc.Server)) Option {
+	return func(c *ServerConfig) {
+		c.adminServices = registerFunc
+	}
+}
+
+// WithInitialWindowSize sets the HTTP/2 stream flow-control window size (in bytes)
+// used by the server and by the client returned by [Server.ClientConn].
+// Values lower than 64KiB are rejected by [ServerConfig.Validate].
+func WithInitialWindowSize(n int32) Option {
+	return func(c *ServerConfig) {
+		c.initialWindowSize = n
+	}
+}
+
+// WithInitialConnWindowSize sets the HTTP/2 connection flow-control window size (in bytes)
+// used by the server and by the client returned by [Server.ClientConn].
+// Values lower than 64KiB are rejected by [ServerConfig.Validate].
+func WithInitialConnWindowSize(n int32) Option {
+	return func(c *ServerConfig) {
+		c.initialConnWindowSize = n
+	}
+}
+
+// WithWriteBufferSize sets the size (in bytes) of the transport write buffer
+// used by the server and by the client returned by [Server.ClientConn].
+// A zero or negative value disables the write buffer, so that each write goes straight to the connection.
+func WithWriteBufferSize(n int) Option {
+	return func(c *ServerConfig) {
+		c.writeBufferSize = &n
+	}
+}
+
+// WithReadBufferSize sets the size (in bytes) of the transport read buffer
+// used by the server and by the client returned by [Server.ClientConn].
+// A zero or negative value disables the read buffer.
+func WithReadBufferSize(n int) Option {
+	return func(c *ServerConfig) {
+		c.readBufferSize = &n
+	}
+}
+
+// WithMaxHeaderListSize sets the maximum size (in bytes) of the header list (i.e. the metadata)
+// the server accepts, instead of gRPC's default. Requests with larger metadata are rejected,
+// which allows to test this defensive limit (e.g., against header bombs).
+//
+// Note: as the limit is advertised to clients, gRPC clients fail such requests with [codes.Internal]
+// before sending them.
+func WithMaxHeaderListSize(n uint32) Option {
+	return func(c *ServerConfig) {
+		c.maxHeaderListSize = &n
+	}
+}
+
+// WithConnectionTimeout sets how long the server waits for the setup of a new connection,
+// including the TLS handshake, before closing it.
+// This is useful to assert the behavior of clients with slow or stuck handshakes.
+func WithConnectionTimeout(d time.Duration) Option {
+	return func(c *ServerConfig) {
+		c.connectionTimeout = d
+	}
+}
+
+// WithMaxConnectionIdle makes the server close connections which have no active RPC
+// for the duration d, by sending a GOAWAY (see [google.golang.org/grpc/keepalive.ServerParameters]).
+// This is useful to assert that clients reconnect after an idle-triggered GOAWAY.
+func WithMaxConnectionIdle(d time.Duration) Option {
+	return func(c *ServerConfig) {
+		c.maxConnectionIdle = d
+	}
+}
+
+// WithCloseTimeout makes [Server.Close] stop the server gracefully, giving in-flight RPCs up to d
+// to complete, before stopping it forcefully. New RPCs are rejected meanwhile.
+// By default, Close stops the server immediately, failing in-flight RPCs.
+func WithCloseTimeout(d time.Duration) Option {
+	return func(c *ServerConfig) {
+		c.closeTimeout = d
+	}
+}
+
+// WithErrorMapper sets a function converting the errors returned by handlers which are not
+// statuses (e.g., domain errors) into statuses, before they are sent to the client.
+// This models the error-translation layer of a production server, to assert that domain errors
+// surface as the expected gRPC codes. Errors returned by the mapper which are not statuses
+// are reported with [codes.Unknown], as usual.
+//
+// Example:
+//
+//	grpctest.WithErrorMapper(func(err error) error {
+//		if errors.Is(err, ErrNotFound) {
+//			return status.Error(codes.NotFound, err.Error())
+//		}
+//		return status.Error(codes.Internal, err.Error())
+//	})
+func WithErrorMapper(mapper func(error) error) Option {
+	return func(c *ServerConfig) {
+		c.errorMapper = mapper
+	}
+}
+
+// WithRecorderCapacity makes the recorder (see [Server.EnableRecording]) keep only the last n calls
+// in a ring buffer, dropping older ones. This bounds memory in long-running stress tests,
+// while still allowing assertions on recent activity.
+func WithRecorderCapacity(n int) Option {
+	return func(c *ServerConfig) {
+		c.recorderCapacity = n
+	}
+}
+
+// WithRandSeed sets the seed of the random failures and delays injected by [Server.SetFlakiness]
+// and [Server.InjectJitter], which makes them reproducible: the same seed produces the same sequence.
+// Each feature draws its own sequence from the seed, so that failures and delays are independent.
+func WithRandSeed(seed int64) Option {
+	return func(c *ServerConfig) {
+		c.randSeed = &seed
+	}
+}
+
+// WithStreamShuffle makes the server buffer the messages sent on each stream, then send them
+// once the handler returns, in an order determined by seed. The same seed always produces the same
+// order for the same number of messages, which makes out-of-order delivery tests reproducible.
+//
+// Note: since nothing is sent until the handler returns, the handlers must not wait for the
+// client to receive a response before returning (e.g., ping-pong bidirectional streams).
+func WithStreamShuffle(seed int64) Option {
+	return func(c *ServerConfig) {
+		c.streamShuffle = &seed
+	}
+}
+
+// WithNumStreamWorkers makes the server handle streams with a shared pool of n worker goroutines
+// (see [grpc.NumStreamWorkers]) instead of a goroutine per stream. A small pool is useful to
+// surface ordering and starvation bugs of streaming services.
+// Zero (the default) disables the pool.
+//
+// Note: when all the workers are busy, gRPC handles new streams in new goroutines.
+func WithNumStreamWorkers(n uint32) Option {
+	return func(c *ServerConfig) {
+		c.numStreamWorkers = n
+	}
+}
+
+// WithBufconn makes the server listen in memory (using google.golang.org/grpc/test/bufconn) instead of on a TCP port.
+// The client returned by [Server.ClientConn] dials the in-memory listener, and [Server.URL]
+// is set to "bufconn". This removes network noise, which is useful for benchmarks.
+func WithBufconn() Option {
+	return func(c *ServerConfig) {
+		c.bufconn = true
+	}
+}
+
+// WithClientConnectParams sets the connect timeout and backoff of the client returned by
+// [Server.ClientConn]. Shortening them lets tests assert that the client gives up quickly
+// when the server is down, rather than waiting for gRPC's defaults.
+func WithClientConnectParams(params grpc.ConnectParams) Option {
+	return func(c *ServerConfig) {
+		c.connectParams = &params
+	}
+}
+
+// WithClientServiceConfig sets the default service config (in JSON) of the clients created by
+// [Server.ClientConn], as normally delivered by the name resolver (see [grpc.WithDefaultServiceConfig]).
+// This allows to test retry, hedging and timeout policies end-to-end, without a real resolver.
+// Invalid JSON is rejected by [ServerConfig.Validate].
+//
+// Example:
+//
+//	grpctest.WithClientServiceConfig(`{"methodConfig": [{"name": [{"service": "hello.Greeter"}], "timeout": "1s"}]}`)
+func WithClientServiceConfig(json string) Option {
+	return func(c *ServerConfig) {
+		c.clientServiceConfig = json
+	}
+}
+
+// WithClientInsecureSkipVerify disables the verification of the server's certificate
+// by the client returned by [Server.ClientConn].
+// This is strictly an escape hatch for negative tests (e.g., to isolate a failure other
+// than a hostname mismatch): by default, the client fully verifies the server.
+func WithClientInsecureSkipVerify() Option {
+	return func(c *ServerConfig) {
+		c.clientInsecureSkipVerify = true
+		c.requireTLS("WithClientInsecureSkipVerify")
+	}
+}
+
+// WithClientServerName sets the server name (SNI) sent by the client returned by [Server.ClientConn]
+// instead of "localhost". The generated certificate is valid for name as well, so that the client
+// still verifies the server. Paired with [Server.ExpectSNI], this allows to test SNI-based routing.
+func WithClientServerName(name string) Option {
+	return func(c *ServerConfig) {
+		c.clientServerName = name
+		c.requireTLS("WithClientServerName")
+	}
+}
+
+// WithClientCipherSuites restricts the cipher suites offered by the client returned by
+// [Server.ClientConn] (see [crypto/tls.Config.CipherSuites]).
+// Paired with a server restricted to other cipher suites, it deterministically produces
+// a handshake failure, to assert the resulting error.
+//
+// Note: TLS 1.3 cipher suites are not configurable, thus the server must be limited
+// to TLS 1.2 (e.g., with [crypto/tls.Config.MaxVersion]) for the restriction to have an effect.
+func WithClientCipherSuites(suites []uint16) Option {
+	return func(c *ServerConfig) {
+		c.clientCipherSuites = slices.Clone(suites)
+		c.requireTLS("WithClientCipherSuites")
+	}
+}
+
+// WithUnknownMethodCode makes the server fail calls to unknown services and methods with the given
+// status code instead of [codes.Unimplemented] (e.g., [codes.NotFound], as some gateways do).
+// [codes.OK] is rejected by [ServerConfig.Validate].
+func WithUnknownMethodCode(code codes.Code) Option {
+	return func(c *ServerConfig) {
+		c.unknownMethodCode = &code
+	}
+}
+
+// WithMetadataEcho makes the server echo the metadata of each request in the response trailers,
+// with keys prefixed by [MetadataEchoPrefix] (e.g., "authorization" is echoed as "echo-authorization").
+// Tests can then read the trailers to check exactly which metadata reached the server.
+func WithMetadataEcho() Option {
+	return func(c *ServerConfig) {
+		c.metadataEcho = true
+	}
+}
+
+// WithRawRequestCapture records the raw wire bytes of each request message received by the server,
+// before unmarshalling. The bytes of the last message are available through [Server.LastRawRequest].
+// This helps diagnose serialization mismatches that a decoded message would hide.
+func WithRawRequestCapture() Option {
+	return func(c *ServerConfig) {
+		c.rawRequestCapture = true
+	}
+}
+
+// WithTLSOnlyUnaryInterceptor installs the given unary interceptors only when the server is
+// started with [Server.StartTLS]; they are ignored on a plain text server.
+// This suits interceptors assuming that the peer has TLS auth info (e.g., reading client certificates),
+// while sharing the same options between plain text and TLS tests.
+func WithTLSOnlyUnaryInterceptor(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(c *ServerConfig) {
+		c.tlsUnaryInterceptors = append(c.tlsUnaryInterceptors, interceptors...)
+	}
+}
+
+// WithStrictTLS makes [Server.StartTLS] check the served certificate, either generated or preset in
+// [Server.TLS]: its key must be ECDSA (P-256 or stronger), RSA (2048 bits or more) or Ed25519, and
+// it must be valid at the time the server starts. Otherwise, StartTLS panics like it does for an
+// invalid configuration.
+// This prevents tests from silently relying on weak or expired fixtures.
+func WithStrictTLS() Option {
+	return func(c *ServerConfig) {
+		c.strictTLS = true
+		c.requireTLS("WithStrictTLS")
+	}
+}
+
+// WithALPN sets the application protocols (i.e. NextProtos) advertised by the server
+// during the TLS handshake, in order of preference.
+// Note that gRPC always adds "h2" to the advertised protocols, since HTTP/2 is required by gRPC.
+// This is useful to test clients relying on ALPN, including when they offer a mismatching set of protocols.
+func WithALPN(protos []string) Option {
+	return func(c *ServerConfig) {
+		c.alpn = slices.Clone(protos)
+		c.requireTLS("WithALPN")
+	}
+}
+
+// WithSessionTicketsDisabled disables (or re-enables) TLS session resumption by the server
+// (see [crypto/tls.Config.SessionTicketsDisabled]), forcing full handshakes on new connections.
+// Combined with [Server.LastHandshakeResumed], it verifies the behavior of clients relying on session resumption.
+func WithSessionTicketsDisabled(disabled bool) Option {
+	return func(c *ServerConfig) {
+		c.sessionTicketsDisabled = disabled
+		c.requireTLS("WithSessionTicketsDisabled")
+	}
+}
+
+// WithPreServe registers a hook called with the address of the server once its listener is bound,
+// right before the server starts serving (e.g., to publish the address to a service registry used by the test).
+// Hooks are called in order, synchronously within [Server.Start] and [Server.StartTLS].
+//
+// Note: hooks must not call methods of the server (e.g., [Server.ClientConn]), since it is not started yet.
+func WithPreServe(hook func(addr net.Addr)) Option {
+	return func(c *ServerConfig) {
+		c.preServe = append(c.preServe, hook)
+	}
+}
+
+// WithPostClose registers a hook called at the end of [Server.Close], once the server and its
+// connections are closed (e.g., to clean up temporary files or external processes tied to the server).
+// Hooks are called in order, exactly once even if Close is called several times.
+//
+// Note: hooks must not call methods of the server, since they run within Close.
+func WithPostClose(hook func()) Option {
+	return func(c *ServerConfig) {
+		c.postClose = append(c.postClose, hook)
+	}
+}
+
+// WithRawConnInspector sets a function wrapping each connection accepted by the server,
+// before it reaches the gRPC transport (e.g., to log or corrupt the HTTP/2 connection preface).
+// This enables transport-level fault injection, which interceptors cannot achieve.
+// The function must return a non-nil connection, usually wrapping the given one.
+//
+// Note: for TLS servers, the connection carries the encrypted bytes, since the TLS handshake
+// is performed by the gRPC transport.
+func WithRawConnInspector(inspect func(conn net.Conn) net.Conn) Option {
+	return func(c *ServerConfig) {
+		c.rawConnInspector = inspect
+	}
+}
+
+// WithConnStateHook sets a function called with the remote address of each transport connection
+// when the server accepts it ([ConnAccepted]) and when it is closed ([ConnClosed]), whichever side closes it.
+// This lets tests count and assert connection churn (e.g., that an idle connection was closed,
+// see [WithMaxConnectionIdle]), which interceptors cannot observe.
+// The hook may be called concurrently, and connections to the admin server are not reported.
+func WithConnStateHook(hook func(addr net.Addr, state string)) Option {
+	return func(c *ServerConfig) {
+		c.connStateHook = hook
+	}
+}
@@ -0,0 +1,870 @@
+package grpctest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestWithCertRandAndClock(t *testing.T) {
+	fixedTime := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	newServer := func() *grpctest.Server {
+		return grpctest.NewTLSServer(func(s *grpc.Server) {
+			pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+		},
+			grpctest.WithCertRand(rand.New(rand.NewSource(42))),
+			grpctest.WithCertClock(func() time.Time { return fixedTime }),
+		)
+	}
+
+	server1 := newServer()
+	defer server1.Close()
+	server2 := newServer()
+	defer server2.Close()
+
+	cert1, cert2 := server1.Certificate(), server2.Certificate()
+	if !bytes.Equal(cert1.Raw, cert2.Raw) {
+		t.Error("expected identical certificates")
+	}
+	if !cert1.NotBefore.Equal(fixedTime) {
+		t.Errorf("expected NotBefore %v, got %v", fixedTime, cert1.NotBefore)
+	}
+
+	// The key derived from the reader is usable for handshakes
+	server3 := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithCertRand(rand.New(rand.NewSource(42))))
+	defer server3.Close()
+	if _, err := pb.NewGreeterClient(server3.ClientConn()).SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWithChannelz(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithChannelz())
+	defer server.Close()
+
+	client := channelzpb.NewChannelzClient(server.ClientConn())
+	resp, err := client.GetServers(context.Background(), &channelzpb.GetServersRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Server) == 0 {
+		t.Error("expected at least one server to be reported by channelz")
+	}
+}
+
+// logRecorder is a [testing.TB] that records messages passed to Logf.
+type logRecorder struct {
+	testing.TB
+	mu   sync.Mutex
+	logs []string
+}
+
+func (r *logRecorder) Logf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs = append(r.logs, fmt.Sprintf(format, args...))
+}
+
+func TestWithLogging(t *testing.T) {
+	recorder := &logRecorder{TB: t}
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithLogging(recorder))
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.logs) != 1 {
+		t.Fatalf("expected 1 log line, got %d: %v", len(recorder.logs), recorder.logs)
+	}
+	if !strings.Contains(recorder.logs[0], "/hello.Greeter/SayHello OK") {
+		t.Errorf("unexpected log line: %s", recorder.logs[0])
+	}
+}
+
+func TestWithLoggingAfterTest(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	var server *grpctest.Server
+	var recorder *logRecorder
+	t.Run("logging", func(t *testing.T) {
+		recorder = &logRecorder{TB: t}
+		server = grpctest.NewServer(func(s *grpc.Server) {
+			pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+				SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+					<-release
+					return &pb.HelloReply{Message: "Hello " + req.Name}, nil
+				},
+			})
+		}, grpctest.WithLogging(recorder))
+
+		client := pb.NewGreeterClient(server.ClientConn())
+		go func() {
+			_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+			done <- err
+		}()
+		// Wait for the RPC to reach the handler
+		for server.TotalCalls() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	defer server.Close()
+
+	// The RPC completes after the logging test: it must not log (testing would panic)
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.logs) != 0 {
+		t.Errorf("expected no log line after the test completed, got %v", recorder.logs)
+	}
+}
+
+func TestWithInitialWindowSize(t *testing.T) {
+	const (
+		messages = 20
+		size     = 32 * 1024
+	)
+	for _, tc := range []struct {
+		name    string
+		window  int32
+		blocked bool
+	}{
+		{name: "small window", window: 64 * 1024, blocked: true},
+		{name: "large window", window: 2 * messages * size, blocked: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var sent atomic.Int32
+			server := grpctest.NewServer(func(s *grpc.Server) {
+				pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+					SayHelloStreamHandler: func(stream pb.Greeter_SayHelloStreamServer) error {
+						for range messages {
+							if err := stream.Send(&pb.HelloReply{Message: strings.Repeat("x", size)}); err != nil {
+								return err
+							}
+							sent.Add(1)
+						}
+						return nil
+					},
+				})
+			},
+				grpctest.WithInitialWindowSize(tc.window),
+				grpctest.WithInitialConnWindowSize(tc.window),
+			)
+			defer server.Close()
+
+			stream, err := pb.NewGreeterClient(server.ClientConn()).SayHelloStream(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// As long as the client doesn't read, the server can only send what fits in the window
+			time.Sleep(200 * time.Millisecond)
+			if got := sent.Load(); (got < messages) != tc.blocked {
+				t.Fatalf("expected the server to be blocked: %v, got %d messages out of %d sent", tc.blocked, got, messages)
+			}
+
+			// Reading unblocks the server
+			for i := range messages {
+				if _, err := stream.Recv(); err != nil {
+					t.Fatalf("message %d: unexpected error: %v", i, err)
+				}
+			}
+			if _, err := stream.Recv(); err != io.EOF {
+				t.Fatalf("expected EOF, got %v", err)
+			}
+			if got := sent.Load(); got != messages {
+				t.Errorf("expected %d messages sent once read, got %d", messages, got)
+			}
+		})
+	}
+}
+
+func TestWithBufconn(t *testing.T) {
+	for _, startTLS := range []bool{false, true} {
+		t.Run(fmt.Sprintf("tls=%v", startTLS), func(t *testing.T) {
+			server := grpctest.NewUnstartedServer(func(s *grpc.Server) {
+				pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+			}, grpctest.WithBufconn())
+			if startTLS {
+				server.StartTLS()
+			} else {
+				server.Start()
+			}
+			defer server.Close()
+
+			if server.URL != "bufconn" {
+				t.Errorf("expected URL 'bufconn', got %q", server.URL)
+			}
+
+			resp, err := pb.NewGreeterClient(server.ClientConn()).SayHello(context.Background(), &pb.HelloRequest{Name: "Buf"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.Message != "Hello Buf" {
+				t.Errorf("expected 'Hello Buf', got '%s'", resp.Message)
+			}
+		})
+	}
+}
+
+func TestWithClientConnectParams(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithClientConnectParams(grpc.ConnectParams{
+		Backoff:           backoff.Config{BaseDelay: 10 * time.Millisecond, Multiplier: 1.6, MaxDelay: 50 * time.Millisecond},
+		MinConnectTimeout: 100 * time.Millisecond,
+	}))
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	call := func(timeout time.Duration) (time.Duration, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		start := time.Now()
+		_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}, grpc.WaitForReady(true))
+		return time.Since(start), err
+	}
+
+	if _, err := call(5 * time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// While the server is unreachable, calls give up within their bound. The first one
+	// may fail on the dropped connection, the next ones wait for the client to reconnect
+	server.Partition()
+	const bound = 300 * time.Millisecond
+	for range 2 {
+		elapsed, err := call(bound)
+		if code := status.Code(err); code != codes.Unavailable && code != codes.DeadlineExceeded {
+			t.Fatalf("expected the call to fail while the server is unreachable, got %v", err)
+		}
+		if elapsed > 2*bound {
+			t.Errorf("expected the call to fail within %v, took %v", bound, elapsed)
+		}
+	}
+
+	// The failed attempts backed off for at most MaxDelay (rather than gRPC's default of 1s
+	// and more), so the client reconnects well before the deadline once the server is reachable
+	server.Heal()
+	if elapsed, err := call(bound); err != nil {
+		t.Fatalf("expected the client to reconnect within %v, got %v after %v", bound, err, elapsed)
+	}
+}
+
+func TestWithTLSOnlyUnaryInterceptor(t *testing.T) {
+	var calls atomic.Int32
+	interceptor := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		// Would panic on a plain text server
+		p, _ := peer.FromContext(ctx)
+		_ = p.AuthInfo.(credentials.TLSInfo)
+		calls.Add(1)
+		return handler(ctx, req)
+	}
+	register := func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}
+
+	for _, tc := range []struct {
+		name      string
+		newServer func(func(*grpc.Server), ...grpctest.Option) *grpctest.Server
+		wantCalls int32
+	}{
+		{name: "plain text", newServer: grpctest.NewServer, wantCalls: 0},
+		{name: "TLS", newServer: grpctest.NewTLSServer, wantCalls: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls.Store(0)
+			server := tc.newServer(register, grpctest.WithTLSOnlyUnaryInterceptor(interceptor))
+			defer server.Close()
+
+			client := pb.NewGreeterClient(server.ClientConn())
+			if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := calls.Load(); got != tc.wantCalls {
+				t.Errorf("expected %d interceptor calls, got %d", tc.wantCalls, got)
+			}
+		})
+	}
+}
+
+func TestWithConnectionTimeout(t *testing.T) {
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithConnectionTimeout(100*time.Millisecond))
+	defer server.Close()
+
+	// A connection which never starts the TLS handshake is closed by the server
+	conn, err := net.Dial("tcp", server.URL)
+	if err != nil {
+		t.Fatalf("failed to dial server: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("expected connection to be closed by the server, got %v", err)
+	}
+}
+
+func TestWithMaxConnectionIdle(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithMaxConnectionIdle(100*time.Millisecond))
+	defer server.Close()
+
+	conn := server.ClientConn().(*grpc.ClientConn)
+	client := pb.NewGreeterClient(conn)
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The GOAWAY sent by the server once the connection is idle moves the client to IDLE
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for state := conn.GetState(); state != connectivity.Idle; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			t.Fatalf("expected client to become idle, still %v", state)
+		}
+	}
+
+	// The client reconnects on the next call
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error after reconnection: %v", err)
+	}
+	if got := server.AcceptedConns(); got != 2 {
+		t.Errorf("expected 2 accepted connections, got %d", got)
+	}
+}
+
+func TestWithBufferSizes(t *testing.T) {
+	for _, size := range []int{0, 1024, 64 * 1024} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			server := grpctest.NewServer(func(s *grpc.Server) {
+				pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+			},
+				grpctest.WithWriteBufferSize(size),
+				grpctest.WithReadBufferSize(size),
+			)
+			defer server.Close()
+
+			client := pb.NewGreeterClient(server.ClientConn())
+			name := strings.Repeat("x", 10*1024)
+			reply, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: name})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reply.Message != "Hello "+name {
+				t.Errorf("unexpected reply of %d bytes", len(reply.Message))
+			}
+		})
+	}
+}
+
+func TestWithMaxHeaderListSize(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithMaxHeaderListSize(1024))
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx := grpctest.OutgoingContext(context.Background(), "x-small", "value")
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx = grpctest.OutgoingContext(context.Background(), "x-bomb", strings.Repeat("x", 4096))
+	if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"}); status.Code(err) != codes.Internal {
+		t.Errorf("expected oversized metadata to be rejected with Internal, got %v", err)
+	}
+	if got := server.TotalCalls(); got != 1 {
+		t.Errorf("expected the oversized request not to reach the server, got %d calls", got)
+	}
+}
+
+func TestWithClientServiceConfig(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		})
+	}, grpctest.WithClientServiceConfig(`{
+		"methodConfig": [{
+			"name": [{"service": "hello.Greeter", "method": "SayHello"}],
+			"timeout": "0.05s"
+		}]
+	}`))
+	defer server.Close()
+
+	// The timeout of the service config applies without any deadline set by the caller
+	_, err := pb.NewGreeterClient(server.ClientConn()).SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func BenchmarkWithBufferSizes(b *testing.B) {
+	for _, size := range []int{0, 32 * 1024} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			server := grpctest.NewBenchServer(b, func(s *grpc.Server) {
+				pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+			},
+				grpctest.WithWriteBufferSize(size),
+				grpctest.WithReadBufferSize(size),
+			)
+			client := pb.NewGreeterClient(server.ClientConn())
+			ctx := context.Background()
+
+			for b.Loop() {
+				if _, err := client.SayHello(ctx, &pb.HelloRequest{Name: "bench"}); err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+type userKey struct{}
+
+func TestWithContextValues(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				user, _ := ctx.Value(userKey{}).(string)
+				return &pb.HelloReply{Message: "Hello " + user}, nil
+			},
+			SayHelloStreamHandler: func(stream pb.Greeter_SayHelloStreamServer) error {
+				user, _ := stream.Context().Value(userKey{}).(string)
+				return stream.Send(&pb.HelloReply{Message: "Hello " + user})
+			},
+		})
+	}, grpctest.WithContextValues(map[any]any{userKey{}: "alice"}))
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	ctx := context.Background()
+
+	reply, err := client.SayHello(ctx, &pb.HelloRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reply.Message != "Hello alice" {
+		t.Errorf("expected injected user in unary context, got %q", reply.Message)
+	}
+
+	stream, err := client.SayHelloStream(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reply, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reply.Message != "Hello alice" {
+		t.Errorf("expected injected user in stream context, got %q", reply.Message)
+	}
+}
+
+// fakeClock is a virtual clock which only advances when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestWithClock(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	server := grpctest.NewUnstartedServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithClock(clock.Now, clock.Sleep))
+	server.StartTLS()
+	defer server.Close()
+
+	t.Run("certificate validity", func(t *testing.T) {
+		if got := server.Certificate().NotBefore; !got.Equal(clock.Now()) {
+			t.Errorf("expected certificate valid from %v, got %v", clock.Now(), got)
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		server.SetRateLimit("/hello.Greeter/SayHello", 1)
+		defer server.SetRateLimit("/hello.Greeter/SayHello", 0)
+
+		client := pb.NewGreeterClient(server.ClientConn())
+		call := func() error {
+			_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+			return err
+		}
+		if err := call(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := call(); status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("expected ResourceExhausted, got %v", err)
+		}
+
+		// The token is refilled once the virtual clock advances, without waiting
+		clock.Sleep(time.Second)
+		if err := call(); err != nil {
+			t.Errorf("unexpected error after advancing the clock: %v", err)
+		}
+	})
+}
+
+func TestWithUnknownMethodCode(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithUnknownMethodCode(codes.NotFound))
+	defer server.Close()
+
+	ctx := context.Background()
+	conn := server.ClientConn()
+	for _, method := range []string{"/hello.Greeter/Unknown", "/unknown.Service/Method"} {
+		err := conn.Invoke(ctx, method, &pb.HelloRequest{}, &pb.HelloReply{})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("%s: expected NotFound, got %v", method, err)
+		}
+	}
+
+	// Known methods are not affected
+	if _, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWithPreServe(t *testing.T) {
+	var calls []string
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	},
+		grpctest.WithPreServe(func(addr net.Addr) { calls = append(calls, "first "+addr.String()) }),
+		grpctest.WithPreServe(func(addr net.Addr) { calls = append(calls, "second "+addr.String()) }),
+	)
+	defer server.Close()
+
+	want := []string{"first " + server.URL, "second " + server.URL}
+	if !slices.Equal(calls, want) {
+		t.Errorf("expected hook calls %v, got %v", want, calls)
+	}
+}
+
+func TestWithPostClose(t *testing.T) {
+	var calls []string
+	server := grpctest.NewServer(nil,
+		grpctest.WithPostClose(func() { calls = append(calls, "first") }),
+		grpctest.WithPostClose(func() { calls = append(calls, "second") }),
+	)
+	if len(calls) != 0 {
+		t.Fatalf("expected no hook call before Close, got %v", calls)
+	}
+
+	server.Close()
+	server.Close()
+	if want := []string{"first", "second"}; !slices.Equal(calls, want) {
+		t.Errorf("expected hook calls %v, got %v", want, calls)
+	}
+}
+
+// clientPreface is the HTTP/2 connection preface sent by clients.
+const clientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// prefaceConn is a [net.Conn] sending the connection preface read from the client
+// once complete, optionally corrupting it.
+type prefaceConn struct {
+	net.Conn
+	corrupt bool
+	buf     []byte
+	preface chan<- string
+}
+
+func (c *prefaceConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if remaining := len(clientPreface) - len(c.buf); remaining > 0 {
+		read := b[:min(n, remaining)]
+		c.buf = append(c.buf, read...)
+		if c.corrupt {
+			for i := range read {
+				read[i] = 'X'
+			}
+		}
+		if len(c.buf) == len(clientPreface) {
+			select {
+			case c.preface <- string(c.buf):
+			default: // the client may reconnect several times
+			}
+		}
+	}
+	return n, err
+}
+
+func TestWithRawConnInspector(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		corrupt bool
+		wantErr bool
+	}{
+		{name: "inspect", corrupt: false, wantErr: false},
+		{name: "corrupt", corrupt: true, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			preface := make(chan string, 1)
+			inspector := func(conn net.Conn) net.Conn {
+				return &prefaceConn{Conn: conn, corrupt: tc.corrupt, preface: preface}
+			}
+			server := grpctest.NewServer(func(s *grpc.Server) {
+				pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+			}, grpctest.WithRawConnInspector(inspector))
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			client := pb.NewGreeterClient(server.ClientConn())
+			_, err := client.SayHello(ctx, &pb.HelloRequest{Name: "World"})
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+
+			if got := <-preface; got != clientPreface {
+				t.Errorf("expected the HTTP/2 client preface, got %q", got)
+			}
+		})
+	}
+}
+
+func TestWithServerFactory(t *testing.T) {
+	var created, calls atomic.Int32
+	factory := func(opts ...grpc.ServerOption) *grpc.Server {
+		created.Add(1)
+		counter := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			calls.Add(1)
+			return handler(ctx, req)
+		}
+		return grpc.NewServer(append(opts, grpc.ChainUnaryInterceptor(counter))...)
+	}
+
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithServerFactory(factory))
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	reply, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reply.Message != "Hello World" {
+		t.Errorf("expected 'Hello World', got '%s'", reply.Message)
+	}
+	if got := created.Load(); got != 1 {
+		t.Errorf("expected the factory to be called once, got %d", got)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 call through the factory's interceptor, got %d", got)
+	}
+}
+
+func TestWithNumStreamWorkers(t *testing.T) {
+	const (
+		workers = 2
+		streams = 3 * workers
+	)
+	var running atomic.Int32
+	release := make(chan struct{})
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloClientStreamHandler: func(stream pb.Greeter_SayHelloClientStreamServer) error {
+				running.Add(1)
+				<-release
+				return stream.SendAndClose(&pb.HelloReply{Message: "done"})
+			},
+		})
+	}, grpctest.WithNumStreamWorkers(workers))
+	defer server.Close()
+
+	// More streams than workers are blocked in their handlers at the same time
+	done := make(chan []error, 1)
+	go func() {
+		done <- grpctest.RunConcurrent(streams, func(i int) error {
+			stream, err := server.GreeterClientStream(context.Background())
+			if err != nil {
+				return err
+			}
+			if _, err := stream.CloseAndRecv(); err != nil {
+				return err
+			}
+			return nil
+		})
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for running.Load() < streams {
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatalf("expected %d streams to be handled concurrently by %d workers, got %d", streams, workers, running.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	select {
+	case errs := <-done:
+		for _, err := range errs {
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the streams to complete")
+	}
+}
+
+func TestWithStreamShuffle(t *testing.T) {
+	const messages = 10
+	register := func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloStreamHandler: func(stream pb.Greeter_SayHelloStreamServer) error {
+				// The reply is reused, as streaming servers commonly do
+				reply := &pb.HelloReply{}
+				for i := range messages {
+					reply.Message = fmt.Sprint(i)
+					if err := stream.Send(reply); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		})
+	}
+	receive := func(server *grpctest.Server) []string {
+		t.Helper()
+		stream, err := pb.NewGreeterClient(server.ClientConn()).SayHelloStream(context.Background())
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		replies, err := grpctest.CollectStream(stream.Recv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var order []string
+		for _, reply := range replies {
+			order = append(order, reply.Message)
+		}
+		return order
+	}
+
+	server := grpctest.NewServer(register, grpctest.WithStreamShuffle(42))
+	defer server.Close()
+	first := receive(server)
+
+	inOrder := make([]string, messages)
+	for i := range inOrder {
+		inOrder[i] = fmt.Sprint(i)
+	}
+	if slices.Equal(first, inOrder) {
+		t.Errorf("expected the messages to be shuffled, got %v", first)
+	}
+	if got, want := slices.Sorted(slices.Values(first)), slices.Sorted(slices.Values(inOrder)); !slices.Equal(got, want) {
+		t.Fatalf("expected all the messages to be received, got %v", first)
+	}
+
+	// The order is reproducible
+	if second := receive(server); !slices.Equal(first, second) {
+		t.Errorf("expected the same order for the same seed, got %v and %v", first, second)
+	}
+}
+
+func TestWithErrorMapper(t *testing.T) {
+	errNotFound := errors.New("not found")
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloHandler: func(ctx context.Context, req *pb.HelloRequest) (*pb.HelloReply, error) {
+				switch req.Name {
+				case "domain":
+					return nil, fmt.Errorf("greeting %q: %w", req.Name, errNotFound)
+				case "status":
+					return nil, status.Error(codes.PermissionDenied, "denied")
+				}
+				return &pb.HelloReply{Message: "Hello " + req.Name}, nil
+			},
+			SayHelloStreamHandler: func(stream pb.Greeter_SayHelloStreamServer) error {
+				return errNotFound
+			},
+		})
+	}, grpctest.WithErrorMapper(func(err error) error {
+		if errors.Is(err, errNotFound) {
+			return status.Error(codes.NotFound, err.Error())
+		}
+		return status.Error(codes.Internal, err.Error())
+	}))
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	for _, tc := range []struct {
+		name string
+		want codes.Code
+	}{
+		{name: "domain", want: codes.NotFound},
+		{name: "status", want: codes.PermissionDenied},
+		{name: "World", want: codes.OK},
+	} {
+		_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: tc.name})
+		if code := status.Code(err); code != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	stream, err := client.SayHelloStream(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	if _, err := stream.Recv(); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound on the stream, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package grpctest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Ping checks that the server is reachable and serving.
+// If the health service is registered on the server, it performs a health check of the
+// overall server. Otherwise, it connects the cached client (see [Server.ClientConn])
+// and waits for the connection to be ready.
+//
+// It returns nil when the server is serving, making it a single-line readiness gate
+// for integration tests.
+func (s *Server) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.started || s.closed {
+		s.mu.Unlock()
+		return errors.New("grpctest: server not serving")
+	}
+	_, hasHealth := s.server.GetServiceInfo()[healthpb.Health_ServiceDesc.ServiceName]
+	conn := s.defaultClient()
+	s.mu.Unlock()
+
+	if !hasHealth {
+		return waitForReady(ctx, conn)
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return fmt.Errorf("grpctest: health check failed: %w", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("grpctest: server not serving: health status is %v", resp.Status)
+	}
+	return nil
+}
+
+// WarmClient connects the cached client (see [Server.ClientConn]) and waits until the
+// connection is ready, including the TLS handshake, if any. As [grpc.NewClient] is lazy,
+// the first RPC would otherwise pay the connection cost.
+//
+// This is especially useful before b.ResetTimer in benchmarks, so that timed calls are steady-state.
+func (s *Server) WarmClient(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.started || s.closed {
+		s.mu.Unlock()
+		return errors.New("grpctest: server not serving")
+	}
+	conn := s.defaultClient()
+	s.mu.Unlock()
+
+	return waitForReady(ctx, conn)
+}
+
+// waitForReady connects conn and waits until it is ready or ctx is done.
+func waitForReady(ctx context.Context, conn *grpc.ClientConn) error {
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("grpctest: connection not ready (state: %v): %w", state, ctx.Err())
+		}
+	}
+}
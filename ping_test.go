@@ -0,0 +1,84 @@
+package grpctest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestPing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("without health service", func(t *testing.T) {
+		server := grpctest.NewServer(func(s *grpc.Server) {
+			pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+		})
+		defer server.Close()
+
+		if err := server.Ping(ctx); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("with health service", func(t *testing.T) {
+		healthServer := health.NewServer()
+		server := grpctest.NewTLSServer(func(s *grpc.Server) {
+			healthpb.RegisterHealthServer(s, healthServer)
+		})
+		defer server.Close()
+
+		if err := server.Ping(ctx); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		if err := server.Ping(ctx); err == nil {
+			t.Error("expected error when server is not serving, got nil")
+		}
+	})
+
+	t.Run("closed server", func(t *testing.T) {
+		server := grpctest.NewServer(nil)
+		server.Close()
+
+		if err := server.Ping(ctx); err == nil {
+			t.Error("expected error for closed server, got nil")
+		}
+	})
+}
+
+func TestWarmClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	if err := server.WarmClient(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state := server.ClientConn().(*grpc.ClientConn).GetState(); state != connectivity.Ready {
+		t.Errorf("expected the connection to be ready, got %v", state)
+	}
+	if got := server.AcceptedConns(); got != 1 {
+		t.Errorf("expected 1 accepted connection, got %d", got)
+	}
+	if got := server.TotalCalls(); got != 0 {
+		t.Errorf("expected no RPC to warm the client, got %d", got)
+	}
+
+	server.Close()
+	if err := server.WarmClient(ctx); err == nil {
+		t.Error("expected error for closed server, got nil")
+	}
+}
@@ -118,10 +118,11 @@ const file_proto_hello_proto_rawDesc = "" +
 	"\x04name\x18\x01 \x01(\tR\x04name\"&\n" +
 	"\n" +
 	"HelloReply\x12\x18\n" +
-	"\amessage\x18\x01 \x01(\tR\amessage2\x7f\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage2\xc3\x01\n" +
 	"\aGreeter\x124\n" +
 	"\bSayHello\x12\x13.hello.HelloRequest\x1a\x11.hello.HelloReply\"\x00\x12>\n" +
-	"\x0eSayHelloStream\x12\x13.hello.HelloRequest\x1a\x11.hello.HelloReply\"\x00(\x010\x01B,Z*github.com/loicsikidi/grpctest/proto/hellob\x06proto3"
+	"\x0eSayHelloStream\x12\x13.hello.HelloRequest\x1a\x11.hello.HelloReply\"\x00(\x010\x01\x12B\n" +
+	"\x14SayHelloClientStream\x12\x13.hello.HelloRequest\x1a\x11.hello.HelloReply\"\x00(\x01B,Z*github.com/loicsikidi/grpctest/proto/hellob\x06proto3"
 
 var (
 	file_proto_hello_proto_rawDescOnce sync.Once
@@ -143,10 +144,12 @@ var file_proto_hello_proto_goTypes = []any{
 var file_proto_hello_proto_depIdxs = []int32{
 	0, // 0: hello.Greeter.SayHello:input_type -> hello.HelloRequest
 	0, // 1: hello.Greeter.SayHelloStream:input_type -> hello.HelloRequest
-	1, // 2: hello.Greeter.SayHello:output_type -> hello.HelloReply
-	1, // 3: hello.Greeter.SayHelloStream:output_type -> hello.HelloReply
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
+	0, // 2: hello.Greeter.SayHelloClientStream:input_type -> hello.HelloRequest
+	1, // 3: hello.Greeter.SayHello:output_type -> hello.HelloReply
+	1, // 4: hello.Greeter.SayHelloStream:output_type -> hello.HelloReply
+	1, // 5: hello.Greeter.SayHelloClientStream:output_type -> hello.HelloReply
+	3, // [3:6] is the sub-list for method output_type
+	0, // [0:3] is the sub-list for method input_type
 	0, // [0:0] is the sub-list for extension type_name
 	0, // [0:0] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
@@ -0,0 +1,87 @@
+package grpctest
+
+import (
+	"slices"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// RecordedCall is an RPC recorded by the server (see [Server.EnableRecording]).
+type RecordedCall struct {
+	// FullMethod is the full method name of the RPC (e.g., "/hello.Greeter/SayHello").
+	FullMethod string
+	// Request is a copy of the request of a unary RPC (nil for streaming RPCs).
+	Request proto.Message
+	// Response is a copy of the response of a successful unary RPC (nil otherwise).
+	Response proto.Message
+	// Err is the error returned to the client (nil on success).
+	Err error
+}
+
+// recorder keeps the recorded calls in a ring buffer of the given capacity (0 means unbounded).
+type recorder struct {
+	capacity int
+	calls    []RecordedCall
+	oldest   int // index of the oldest call once the buffer is full
+}
+
+// add records c, dropping the oldest call if the buffer is full.
+func (r *recorder) add(c RecordedCall) {
+	if r.capacity == 0 || len(r.calls) < r.capacity {
+		r.calls = append(r.calls, c)
+		return
+	}
+	r.calls[r.oldest] = c
+	r.oldest = (r.oldest + 1) % r.capacity
+}
+
+// window returns a copy of the recorded calls, from the oldest to the most recent.
+func (r *recorder) window() []RecordedCall {
+	return append(slices.Clone(r.calls[r.oldest:]), r.calls[:r.oldest]...)
+}
+
+// EnableRecording records every RPC received by the server, including the ones rejected
+// by injected errors, rate limits, etc. Recorded calls are available through [Server.Recorded].
+//
+// By default, all the calls are kept: use [WithRecorderCapacity] to bound memory
+// in long-running stress tests.
+func (s *Server) EnableRecording() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.recording = true
+}
+
+// Recorded returns the calls recorded since [Server.EnableRecording] was called,
+// from the oldest to the most recent. With [WithRecorderCapacity], only the last calls are returned.
+// Returns nil if recording is not enabled or if no RPC has completed yet.
+func (s *Server) Recorded() []RecordedCall {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if s.recorded == nil {
+		return nil
+	}
+	return s.recorded.window()
+}
+
+// record records the outcome of an RPC, if recording is enabled.
+// The req and resp of unary RPCs are copied if they are protobuf messages.
+func (s *Server) record(fullMethod string, req, resp any, err error) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	if !s.recording {
+		return
+	}
+	call := RecordedCall{FullMethod: fullMethod, Err: err}
+	if m, ok := req.(proto.Message); ok {
+		call.Request = proto.Clone(m)
+	}
+	if m, ok := resp.(proto.Message); ok && err == nil {
+		call.Response = proto.Clone(m)
+	}
+	if s.recorded == nil {
+		s.recorded = &recorder{capacity: s.Config.recorderCapacity}
+	}
+	s.recorded.add(call)
+}
@@ -0,0 +1,94 @@
+package grpctest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRecorded(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "ignored"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := server.Recorded(); got != nil {
+		t.Fatalf("expected no call recorded before recording is enabled, got %v", got)
+	}
+
+	server.EnableRecording()
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "Alice"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stream, err := server.GreeterClientStream(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server.InjectErrorWithDetails("/hello.Greeter/SayHello", status.New(codes.Unavailable, "down"))
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "Bob"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	calls := server.Recorded()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 recorded calls, got %d", len(calls))
+	}
+	if calls[0].FullMethod != "/hello.Greeter/SayHello" ||
+		!proto.Equal(calls[0].Request, &pb.HelloRequest{Name: "Alice"}) ||
+		!proto.Equal(calls[0].Response, &pb.HelloReply{Message: "Hello Alice"}) ||
+		calls[0].Err != nil {
+		t.Errorf("unexpected first call: %+v", calls[0])
+	}
+	if calls[1].FullMethod != "/hello.Greeter/SayHelloClientStream" || calls[1].Request != nil || calls[1].Err != nil {
+		t.Errorf("unexpected second call: %+v", calls[1])
+	}
+	if calls[2].Response != nil || status.Code(calls[2].Err) != codes.Unavailable {
+		t.Errorf("unexpected third call: %+v", calls[2])
+	}
+
+	server.Reset()
+	if got := server.Recorded(); got != nil {
+		t.Errorf("expected no call recorded after reset, got %v", got)
+	}
+}
+
+func TestWithRecorderCapacity(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithRecorderCapacity(3))
+	defer server.Close()
+
+	server.EnableRecording()
+	client := pb.NewGreeterClient(server.ClientConn())
+	for i := range 7 {
+		if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: fmt.Sprint(i)}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Only the last 3 calls are kept, from the oldest to the most recent
+	calls := server.Recorded()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 recorded calls, got %d", len(calls))
+	}
+	for i, call := range calls {
+		want := &pb.HelloRequest{Name: fmt.Sprint(i + 4)}
+		if !proto.Equal(call.Request, want) {
+			t.Errorf("expected request %v at index %d, got %v", want, i, call.Request)
+		}
+	}
+}
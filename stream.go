@@ -0,0 +1,80 @@
+package grpctest
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// CollectStream calls recv until it returns [io.EOF] and returns all the received messages,
+// so that tests can assert on the full sequence with a single comparison.
+// If recv fails with another error, the messages received so far are returned along with the error.
+//
+// Example:
+//
+//	stream, _ := client.SayHelloStream(ctx)
+//	stream.Send(&pb.HelloRequest{Name: "World"})
+//	stream.CloseSend()
+//	replies, err := grpctest.CollectStream(stream.Recv)
+func CollectStream[T any](recv func() (T, error)) ([]T, error) {
+	var msgs []T
+	for {
+		msg, err := recv()
+		if errors.Is(err, io.EOF) {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+// AssertStreamEOF fails the test unless the next call to recv returns [io.EOF], i.e. the stream
+// was closed cleanly without extra messages. The unexpected message or error is reported.
+// Passing the Recv method of a stream (e.g., stream.Recv) avoids any type conversion.
+//
+// Example:
+//
+//	reply, _ := stream.Recv()
+//	// ... assert on the expected reply ...
+//	grpctest.AssertStreamEOF(t, stream.Recv)
+func AssertStreamEOF[T any](tb testing.TB, recv func() (T, error)) {
+	tb.Helper()
+
+	msg, err := recv()
+	switch {
+	case errors.Is(err, io.EOF):
+	case err != nil:
+		tb.Errorf("grpctest: expected end of stream, got error: %v", err)
+	default:
+		tb.Errorf("grpctest: expected end of stream, got message: %v", msg)
+	}
+}
+
+// AssertHeaderBeforeData fails the test unless the server sent the response headers of stream
+// before any message or status, i.e. the stream did not end with a trailers-only response.
+// It blocks until the headers are received, and must be called before the first RecvMsg.
+// This exercises the ordering guarantees of gRPC headers, which are easy to get wrong
+// in custom stream handlers (e.g., setting headers after the first message is sent).
+//
+// Example:
+//
+//	stream, _ := client.SayHelloStream(ctx)
+//	stream.Send(&pb.HelloRequest{Name: "World"})
+//	grpctest.AssertHeaderBeforeData(t, stream)
+//	reply, _ := stream.Recv()
+func AssertHeaderBeforeData(tb testing.TB, stream grpc.ClientStream) {
+	tb.Helper()
+
+	md, err := stream.Header()
+	switch {
+	case err != nil:
+		tb.Errorf("grpctest: failed to receive headers: %v", err)
+	case md == nil:
+		// The status is discovered by RecvMsg
+		tb.Errorf("grpctest: stream ended without headers: %v", stream.RecvMsg(new(any)))
+	}
+}
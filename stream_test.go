@@ -0,0 +1,186 @@
+package grpctest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestCollectStream(t *testing.T) {
+	const messages = 3
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloStreamHandler: func(stream pb.Greeter_SayHelloStreamServer) error {
+				req, err := stream.Recv()
+				if err != nil {
+					return err
+				}
+				for i := range messages {
+					if err := stream.Send(&pb.HelloReply{Message: fmt.Sprintf("Hello %s %d", req.Name, i)}); err != nil {
+						return err
+					}
+				}
+				if req.Name == "fail" {
+					return status.Error(codes.Internal, "failure")
+				}
+				return nil
+			},
+		})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	collect := func(name string) ([]*pb.HelloReply, error) {
+		stream, err := client.SayHelloStream(context.Background())
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatalf("failed to close send: %v", err)
+		}
+		return grpctest.CollectStream(stream.Recv)
+	}
+
+	t.Run("until EOF", func(t *testing.T) {
+		replies, err := collect("World")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(replies) != messages {
+			t.Fatalf("expected %d replies, got %d", messages, len(replies))
+		}
+		for i, reply := range replies {
+			if want := fmt.Sprintf("Hello World %d", i); reply.Message != want {
+				t.Errorf("reply %d: expected %q, got %q", i, want, reply.Message)
+			}
+		}
+	})
+
+	t.Run("partial on error", func(t *testing.T) {
+		replies, err := collect("fail")
+		if status.Code(err) != codes.Internal {
+			t.Errorf("expected Internal error, got %v", err)
+		}
+		if len(replies) != messages {
+			t.Errorf("expected %d replies before the error, got %d", messages, len(replies))
+		}
+	})
+}
+
+func TestAssertStreamEOF(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloStreamHandler: func(stream pb.Greeter_SayHelloStreamServer) error {
+				req, err := stream.Recv()
+				if err != nil {
+					return err
+				}
+				if req.Name == "fail" {
+					return status.Error(codes.Internal, "failure")
+				}
+				for range 2 {
+					if err := stream.Send(&pb.HelloReply{Message: "Hello " + req.Name}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	tests := []struct {
+		name       string
+		request    string
+		receive    int
+		wantFailed bool
+	}{
+		{name: "end of stream", request: "World", receive: 2, wantFailed: false},
+		{name: "extra message", request: "World", receive: 1, wantFailed: true},
+		{name: "error", request: "fail", receive: 0, wantFailed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.SayHelloStream(context.Background())
+			if err != nil {
+				t.Fatalf("failed to open stream: %v", err)
+			}
+			if err := stream.Send(&pb.HelloRequest{Name: tt.request}); err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+			for range tt.receive {
+				if _, err := stream.Recv(); err != nil {
+					t.Fatalf("failed to receive: %v", err)
+				}
+			}
+
+			recorder := &errorRecorder{TB: t}
+			grpctest.AssertStreamEOF(recorder, stream.Recv)
+			if recorder.failed != tt.wantFailed {
+				t.Errorf("expected failure %v, got %v (%s)", tt.wantFailed, recorder.failed, recorder.message)
+			}
+		})
+	}
+}
+
+func TestAssertHeaderBeforeData(t *testing.T) {
+	server := grpctest.NewServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{
+			SayHelloStreamHandler: func(stream pb.Greeter_SayHelloStreamServer) error {
+				req, err := stream.Recv()
+				if err != nil {
+					return err
+				}
+				switch req.Name {
+				case "fail":
+					return status.Error(codes.Internal, "failure")
+				case "headers only":
+					return stream.SendHeader(metadata.Pairs("x-header", "value"))
+				}
+				return stream.Send(&pb.HelloReply{Message: "Hello " + req.Name})
+			},
+		})
+	})
+	defer server.Close()
+
+	client := pb.NewGreeterClient(server.ClientConn())
+	tests := []struct {
+		name       string
+		request    string
+		wantFailed bool
+	}{
+		{name: "message", request: "World", wantFailed: false},
+		{name: "headers only", request: "headers only", wantFailed: false},
+		{name: "trailers only", request: "fail", wantFailed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.SayHelloStream(context.Background())
+			if err != nil {
+				t.Fatalf("failed to open stream: %v", err)
+			}
+			if err := stream.Send(&pb.HelloRequest{Name: tt.request}); err != nil {
+				t.Fatalf("failed to send: %v", err)
+			}
+
+			recorder := &errorRecorder{TB: t}
+			grpctest.AssertHeaderBeforeData(recorder, stream)
+			if recorder.failed != tt.wantFailed {
+				t.Errorf("expected failure %v, got %v (%s)", tt.wantFailed, recorder.failed, recorder.message)
+			}
+		})
+	}
+}
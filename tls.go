@@ -0,0 +1,222 @@
+package grpctest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ErrUnexpectedSNI is wrapped by the error rejecting the TLS handshakes whose server name
+// does not match the one set with [Server.ExpectSNI].
+var ErrUnexpectedSNI = errors.New("grpctest: unexpected server name (SNI)")
+
+// ClientTLSCreds returns client transport credentials trusting the given CA certificate.
+// The serverName is used to verify the hostname on the certificate returned by the server.
+//
+// This is useful to dial servers using your own certificate authority, including
+// external servers in integration tests.
+//
+// Example:
+//
+//	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(
+//		grpctest.ClientTLSCreds(caCert, "localhost"),
+//	))
+func ClientTLSCreds(caCert *x509.Certificate, serverName string) credentials.TransportCredentials {
+	certPool := x509.NewCertPool()
+	certPool.AddCert(caCert)
+
+	return credentials.NewTLS(&tls.Config{
+		RootCAs:    certPool,
+		ServerName: serverName,
+	})
+}
+
+// GenerateMTLSPair generates a certificate authority, along with a server and a client
+// certificate signed by it, for mutual TLS tests.
+// The server certificate is valid for "localhost", 127.0.0.1 and ::1.
+// The returned pool trusts the certificate authority: use it as the server's ClientCAs
+// and as the client's RootCAs.
+//
+// Calling GenerateMTLSPair twice produces two unrelated authorities, which is useful
+// to test that a client certificate signed by an untrusted authority is rejected.
+//
+// Example:
+//
+//	caPool, serverCert, clientCert, err := grpctest.GenerateMTLSPair()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	server := grpctest.NewUnstartedServer(registerFunc)
+//	server.TLS = &tls.Config{
+//		Certificates: []tls.Certificate{serverCert},
+//		ClientCAs:    caPool,
+//		ClientAuth:   tls.RequireAndVerifyClientCert,
+//	}
+//	server.StartTLS()
+//	conn := server.ClientConn(grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+//		Certificates: []tls.Certificate{clientCert},
+//		RootCAs:      caPool,
+//		ServerName:   "localhost",
+//	})))
+func GenerateMTLSPair() (caPool *x509.CertPool, serverCert, clientCert tls.Certificate, err error) {
+	ca, err := issueCertificate(&x509.Certificate{
+		Subject:               pkix.Name{Organization: []string{"grpctest"}, CommonName: "grpctest CA"},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil)
+	if err != nil {
+		return nil, tls.Certificate{}, tls.Certificate{}, fmt.Errorf("failed to generate CA certificate: %w", err)
+	}
+
+	serverCert, err = issueCertificate(&x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"grpctest"}, CommonName: "localhost"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}, &ca)
+	if err != nil {
+		return nil, tls.Certificate{}, tls.Certificate{}, fmt.Errorf("failed to generate server certificate: %w", err)
+	}
+
+	clientCert, err = issueCertificate(&x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"grpctest"}, CommonName: "grpctest client"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+	if err != nil {
+		return nil, tls.Certificate{}, tls.Certificate{}, fmt.Errorf("failed to generate client certificate: %w", err)
+	}
+
+	caPool = x509.NewCertPool()
+	caPool.AddCert(ca.Leaf)
+	return caPool, serverCert, clientCert, nil
+}
+
+// issueCertificate generates a key pair and a certificate from template, valid for 24 hours.
+// The certificate is signed by parent, or self-signed if parent is nil.
+func issueCertificate(template *x509.Certificate, parent *tls.Certificate) (tls.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	template.SerialNumber = serialNumber
+	template.NotBefore = time.Now()
+	template.NotAfter = template.NotBefore.Add(24 * time.Hour)
+
+	issuer, issuerKey := template, crypto.Signer(priv)
+	if parent != nil {
+		issuer, issuerKey = parent.Leaf, parent.PrivateKey.(crypto.Signer)
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, issuer, &priv.PublicKey, issuerKey)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(derBytes)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{derBytes},
+		PrivateKey:  priv,
+		Leaf:        cert,
+	}, nil
+}
+
+// minRSAKeySize is the smallest RSA key size (in bits) accepted by [WithStrictTLS].
+const minRSAKeySize = 2048
+
+// checkStrictCertificate checks that cert uses an approved key type and is valid at the given time.
+func checkStrictCertificate(cert *x509.Certificate, now time.Time) error {
+	if cert == nil {
+		return errors.New("strict TLS requires the certificate to be set in TLS.Certificates")
+	}
+
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if key.Curve.Params().BitSize < 256 {
+			return fmt.Errorf("weak ECDSA certificate key: %s", key.Curve.Params().Name)
+		}
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeySize {
+			return fmt.Errorf("weak RSA certificate key: %d bits, want at least %d", key.N.BitLen(), minRSAKeySize)
+		}
+	case ed25519.PublicKey:
+	default:
+		return fmt.Errorf("unapproved certificate key type: %T", key)
+	}
+
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate not valid before %v", cert.NotBefore)
+	}
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate expired on %v", cert.NotAfter)
+	}
+	return nil
+}
+
+// ExpectSNI makes the server reject the TLS handshakes whose server name (SNI) is not name,
+// with an error wrapping [ErrUnexpectedSNI] (the client observes a TLS alert).
+// Paired with [WithClientServerName], this allows to assert that clients send the correct SNI.
+// The expectation is removed by [Server.Reset]. It has no effect on plaintext servers.
+func (s *Server) ExpectSNI(name string) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.expectedSNI = &name
+}
+
+// checkSNI returns a [tls.Config.GetConfigForClient] callback rejecting the ClientHello
+// if its server name is not the expected one, then delegating to next (if any).
+func (s *Server) checkSNI(next func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		s.stateMu.Lock()
+		expected := s.expectedSNI
+		s.stateMu.Unlock()
+
+		if expected != nil && hello.ServerName != *expected {
+			return nil, fmt.Errorf("%w: got %q, want %q", ErrUnexpectedSNI, hello.ServerName, *expected)
+		}
+		if next != nil {
+			return next(hello)
+		}
+		return nil, nil
+	}
+}
+
+// UntrustedClientConn returns a new client connection to the test server which trusts no
+// certificate (i.e. with an empty root pool, but without skipping the verification),
+// so that every handshake fails with a certificate verification error.
+// This is a fixture for negative TLS tests, asserting how clients surface untrusted certificates.
+//
+// Like [Server.ClientConn] with options, a new connection is created on each call,
+// and it is closed when the server is closed. It panics if the server does not use TLS.
+func (s *Server) UntrustedClientConn() grpc.ClientConnInterface {
+	config := s.ClientTLSConfig()
+	if config == nil {
+		panic("grpctest: UntrustedClientConn requires a TLS server")
+	}
+	config.RootCAs = x509.NewCertPool()
+	config.InsecureSkipVerify = false
+	return s.ClientConn(grpc.WithTransportCredentials(credentials.NewTLS(config)))
+}
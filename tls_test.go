@@ -0,0 +1,558 @@
+package grpctest_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loicsikidi/grpctest"
+	pb "github.com/loicsikidi/grpctest/proto/hello"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientTLSCreds(t *testing.T) {
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	conn, err := grpc.NewClient(server.URL, grpc.WithTransportCredentials(
+		grpctest.ClientTLSCreds(server.Certificate(), "localhost"),
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	resp, err := pb.NewGreeterClient(conn).SayHello(context.Background(), &pb.HelloRequest{Name: "CA"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Message != "Hello CA" {
+		t.Errorf("expected 'Hello CA', got '%s'", resp.Message)
+	}
+}
+
+func TestRotateCertificate(t *testing.T) {
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	ctx := context.Background()
+	oldClient := pb.NewGreeterClient(server.ClientConn())
+	if _, err := oldClient.SayHello(ctx, &pb.HelloRequest{Name: "before"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	oldCert := server.Certificate()
+
+	if err := server.RotateCertificate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	newCert := server.Certificate()
+	if newCert.Equal(oldCert) {
+		t.Fatal("expected a new certificate after rotation")
+	}
+
+	// Existing connections continue to work
+	if _, err := oldClient.SayHello(ctx, &pb.HelloRequest{Name: "after"}); err != nil {
+		t.Errorf("unexpected error on existing connection: %v", err)
+	}
+
+	// New handshakes use the new certificate
+	conn, err := grpc.NewClient(server.URL, grpc.WithTransportCredentials(
+		grpctest.ClientTLSCreds(newCert, "localhost"),
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	if _, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "new"}); err != nil {
+		t.Errorf("unexpected error with new certificate: %v", err)
+	}
+
+	// Including for clients dialing an IP address, which send no SNI
+	ipConn, err := grpc.NewClient(server.URL, grpc.WithTransportCredentials(
+		grpctest.ClientTLSCreds(newCert, "127.0.0.1"),
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ipConn.Close()
+	if _, err := pb.NewGreeterClient(ipConn).SayHello(ctx, &pb.HelloRequest{Name: "new"}); err != nil {
+		t.Errorf("unexpected error with new certificate and no SNI: %v", err)
+	}
+}
+
+func TestRotateCertificateWithoutTLS(t *testing.T) {
+	server := grpctest.NewServer(nil)
+	defer server.Close()
+
+	if err := server.RotateCertificate(); err == nil {
+		t.Error("expected error for non-TLS server, got nil")
+	}
+}
+
+func TestStartTLSWithPresetConfig(t *testing.T) {
+	register := func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}
+
+	t.Run("with certificate", func(t *testing.T) {
+		source := grpctest.NewTLSServer(register)
+		defer source.Close()
+
+		server := grpctest.NewUnstartedServer(register)
+		server.TLS = &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{source.Certificate().Raw}, PrivateKey: source.PrivateKey()}},
+			MinVersion:   tls.VersionTLS12,
+		}
+		server.StartTLS()
+		defer server.Close()
+
+		if !server.Certificate().Equal(source.Certificate()) {
+			t.Error("expected the preset certificate to be used")
+		}
+		if server.TLS.MinVersion != tls.VersionTLS12 {
+			t.Errorf("expected preset MinVersion to be kept, got %x", server.TLS.MinVersion)
+		}
+		if err := server.RotateCertificate(); err == nil {
+			t.Error("expected rotation of a user-provided certificate to fail")
+		}
+		if _, err := pb.NewGreeterClient(server.ClientConn()).SayHello(context.Background(), &pb.HelloRequest{Name: "preset"}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("shared between servers", func(t *testing.T) {
+		shared := &tls.Config{MinVersion: tls.VersionTLS12}
+		var servers []*grpctest.Server
+		for range 2 {
+			server := grpctest.NewUnstartedServer(register)
+			server.TLS = shared
+			server.StartTLS()
+			defer server.Close()
+			servers = append(servers, server)
+		}
+
+		if shared.GetCertificate != nil || len(shared.Certificates) > 0 || shared.GetConfigForClient != nil || shared.VerifyConnection != nil {
+			t.Error("expected the preset configuration not to be modified")
+		}
+		if servers[0].Certificate().Equal(servers[1].Certificate()) {
+			t.Error("expected each server to generate its own certificate")
+		}
+		for _, server := range servers {
+			if _, err := pb.NewGreeterClient(server.ClientConn()).SayHello(context.Background(), &pb.HelloRequest{Name: "shared"}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+	})
+
+	t.Run("without certificate", func(t *testing.T) {
+		server := grpctest.NewUnstartedServer(register)
+		server.TLS = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			NextProtos: []string{"h2"},
+		}
+		server.StartTLS()
+		defer server.Close()
+
+		if server.Certificate() == nil {
+			t.Fatal("expected a certificate to be generated")
+		}
+		if server.TLS.MinVersion != tls.VersionTLS12 {
+			t.Errorf("expected preset MinVersion to be kept, got %x", server.TLS.MinVersion)
+		}
+		if _, err := pb.NewGreeterClient(server.ClientConn()).SayHello(context.Background(), &pb.HelloRequest{Name: "preset"}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestClientTLSConfig(t *testing.T) {
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	defer server.Close()
+
+	config := server.ClientTLSConfig()
+	if config == nil {
+		t.Fatal("expected a TLS configuration")
+	}
+	if config.ServerName != "localhost" {
+		t.Errorf("expected server name 'localhost', got %q", config.ServerName)
+	}
+
+	conn, err := grpc.NewClient(server.URL, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	resp, err := pb.NewGreeterClient(conn).SayHello(context.Background(), &pb.HelloRequest{Name: "TLS"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Message != "Hello TLS" {
+		t.Errorf("expected 'Hello TLS', got '%s'", resp.Message)
+	}
+
+	plain := grpctest.NewServer(nil)
+	defer plain.Close()
+	if plain.ClientTLSConfig() != nil {
+		t.Error("expected nil TLS configuration for a non-TLS server")
+	}
+}
+
+func TestPrivateKey(t *testing.T) {
+	server := grpctest.NewTLSServer(nil)
+	defer server.Close()
+
+	key := server.PrivateKey()
+	if key == nil {
+		t.Fatal("expected a private key")
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); !ok {
+		t.Errorf("expected an ECDSA key, got %T", key)
+	}
+	if !server.Certificate().PublicKey.(*ecdsa.PublicKey).Equal(key.Public()) {
+		t.Error("expected the private key to match the certificate")
+	}
+
+	plain := grpctest.NewServer(nil)
+	defer plain.Close()
+	if plain.PrivateKey() != nil {
+		t.Error("expected nil private key for a non-TLS server")
+	}
+}
+
+func TestWithClientInsecureSkipVerify(t *testing.T) {
+	source := grpctest.NewTLSServer(nil)
+	defer source.Close()
+	// The certificate is served through a callback: the client can't trust it
+	getCertificate := source.TLS.GetCertificate
+
+	newServer := func(opts ...grpctest.Option) *grpctest.Server {
+		server := grpctest.NewUnstartedServer(func(s *grpc.Server) {
+			pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+		}, opts...)
+		server.TLS = &tls.Config{GetCertificate: getCertificate}
+		server.StartTLS()
+		return server
+	}
+	ctx := context.Background()
+
+	verified := newServer()
+	defer verified.Close()
+	if _, err := pb.NewGreeterClient(verified.ClientConn()).SayHello(ctx, &pb.HelloRequest{Name: "World"}); err == nil {
+		t.Error("expected verification error, got nil")
+	}
+
+	skipped := newServer(grpctest.WithClientInsecureSkipVerify())
+	defer skipped.Close()
+	if _, err := pb.NewGreeterClient(skipped.ClientConn()).SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGenerateMTLSPair(t *testing.T) {
+	caPool, serverCert, clientCert, err := grpctest.GenerateMTLSPair()
+	if err != nil {
+		t.Fatalf("failed to generate mTLS pair: %v", err)
+	}
+	_, _, untrustedCert, err := grpctest.GenerateMTLSPair()
+	if err != nil {
+		t.Fatalf("failed to generate untrusted mTLS pair: %v", err)
+	}
+
+	server := grpctest.NewUnstartedServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	})
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	call := func(cert tls.Certificate) error {
+		conn := server.ClientConn(grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      caPool,
+			ServerName:   "localhost",
+		})))
+		_, err := pb.NewGreeterClient(conn).SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+		return err
+	}
+
+	if err := call(clientCert); err != nil {
+		t.Errorf("expected trusted client certificate to be accepted, got %v", err)
+	}
+	if err := call(untrustedCert); err == nil {
+		t.Error("expected untrusted client certificate to be rejected")
+	}
+}
+
+func TestWithALPN(t *testing.T) {
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithALPN([]string{"custom", "h2"}))
+	defer server.Close()
+
+	// gRPC clients still negotiate h2
+	client := pb.NewGreeterClient(server.ClientConn())
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	handshake := func(protos ...string) (string, error) {
+		conn, err := tls.Dial("tcp", server.URL, &tls.Config{
+			RootCAs:    roots,
+			ServerName: "localhost",
+			NextProtos: protos,
+		})
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+		return conn.ConnectionState().NegotiatedProtocol, nil
+	}
+
+	if proto, err := handshake("custom"); err != nil || proto != "custom" {
+		t.Errorf("expected custom protocol to be negotiated, got %q (err: %v)", proto, err)
+	}
+	if _, err := handshake("unknown"); err == nil {
+		t.Error("expected handshake to fail with a mismatching protocol")
+	}
+}
+
+func TestWithStrictTLS(t *testing.T) {
+	register := func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}
+	// startTLS returns the panic message of StartTLS, if any
+	startTLS := func(server *grpctest.Server) (msg string) {
+		defer func() {
+			if r := recover(); r != nil {
+				msg = fmt.Sprint(r)
+			}
+		}()
+		server.StartTLS()
+		return ""
+	}
+
+	t.Run("generated certificate", func(t *testing.T) {
+		server := grpctest.NewUnstartedServer(register, grpctest.WithStrictTLS())
+		defer server.Close()
+		if msg := startTLS(server); msg != "" {
+			t.Fatalf("unexpected panic: %s", msg)
+		}
+	})
+
+	t.Run("expired certificate", func(t *testing.T) {
+		server := grpctest.NewUnstartedServer(register,
+			grpctest.WithStrictTLS(),
+			grpctest.WithCertClock(func() time.Time { return time.Now().Add(-48 * time.Hour) }),
+		)
+		defer server.Close()
+		if msg := startTLS(server); !strings.Contains(msg, "expired") {
+			t.Errorf("expected expired certificate to be rejected, got %q", msg)
+		}
+	})
+
+	t.Run("weak key", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			DNSNames:     []string{"localhost"},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatalf("failed to create certificate: %v", err)
+		}
+
+		server := grpctest.NewUnstartedServer(register, grpctest.WithStrictTLS())
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+		defer server.Close()
+		if msg := startTLS(server); !strings.Contains(msg, "weak ECDSA") {
+			t.Errorf("expected weak key to be rejected, got %q", msg)
+		}
+	})
+}
+
+func TestWithCertSubject(t *testing.T) {
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithCertSubject(pkix.Name{
+		CommonName:   "payments",
+		Organization: []string{"acme"},
+	}))
+	defer server.Close()
+
+	subject := server.Certificate().Subject
+	if subject.CommonName != "payments" || len(subject.Organization) != 1 || subject.Organization[0] != "acme" {
+		t.Errorf("unexpected certificate subject: %v", subject)
+	}
+
+	// The client verifies the SANs, not the CommonName
+	client := pb.NewGreeterClient(server.ClientConn())
+	if _, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWithClientCipherSuites(t *testing.T) {
+	const serverSuite = tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	newServer := func(clientSuites []uint16) *grpctest.Server {
+		server := grpctest.NewUnstartedServer(func(s *grpc.Server) {
+			pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+		}, grpctest.WithClientCipherSuites(clientSuites))
+		server.TLS = &tls.Config{
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{serverSuite},
+		}
+		server.StartTLS()
+		return server
+	}
+	ctx := context.Background()
+
+	common := newServer([]uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, serverSuite})
+	defer common.Close()
+	if _, err := pb.NewGreeterClient(common.ClientConn()).SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if suite, _ := common.NegotiatedCipherSuite(); suite != serverSuite {
+		t.Errorf("expected cipher suite %s, got %s", tls.CipherSuiteName(serverSuite), tls.CipherSuiteName(suite))
+	}
+
+	disjoint := newServer([]uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305})
+	defer disjoint.Close()
+	_, err := pb.NewGreeterClient(disjoint.ClientConn()).SayHello(ctx, &pb.HelloRequest{Name: "World"})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "handshake failure") {
+		t.Errorf("expected a handshake failure, got %v", err)
+	}
+}
+
+func TestLastHandshakeResumed(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		opts        []grpctest.Option
+		wantResumed bool
+	}{
+		{name: "session tickets", wantResumed: true},
+		{name: "session tickets disabled", opts: []grpctest.Option{grpctest.WithSessionTicketsDisabled(true)}, wantResumed: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := grpctest.NewTLSServer(func(s *grpc.Server) {
+				pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+			}, tc.opts...)
+			defer server.Close()
+
+			config := server.ClientTLSConfig()
+			config.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+			call := func() {
+				t.Helper()
+				// Each client opens a new connection, sharing the session cache
+				conn := server.ClientConn(grpc.WithTransportCredentials(credentials.NewTLS(config)))
+				defer conn.(*grpc.ClientConn).Close()
+				if _, err := pb.NewGreeterClient(conn).SayHello(context.Background(), &pb.HelloRequest{Name: "World"}); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			call()
+			if server.LastHandshakeResumed() {
+				t.Error("expected the first handshake to be full")
+			}
+			call()
+			if got := server.LastHandshakeResumed(); got != tc.wantResumed {
+				t.Errorf("expected resumed %v, got %v", tc.wantResumed, got)
+			}
+		})
+	}
+}
+
+func TestExpectSNI(t *testing.T) {
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithClientServerName("api.example.com"))
+	defer server.Close()
+
+	ctx := context.Background()
+	server.ExpectSNI("api.example.com")
+	if _, err := pb.NewGreeterClient(server.ClientConn()).SayHello(ctx, &pb.HelloRequest{Name: "World"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hello := server.LastClientHello(); hello == nil || hello.ServerName != "api.example.com" {
+		t.Errorf("expected SNI api.example.com, got %v", hello)
+	}
+
+	// A new connection is needed for a new handshake
+	server.ExpectSNI("other.example.com")
+	conn := server.ClientConn(grpc.WithTransportCredentials(credentials.NewTLS(server.ClientTLSConfig())))
+	defer conn.(*grpc.ClientConn).Close()
+	_, err := pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "World"})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Errorf("expected Unavailable, got %v", err)
+	}
+
+	_, err = server.TLS.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "api.example.com"})
+	if !errors.Is(err, grpctest.ErrUnexpectedSNI) {
+		t.Errorf("expected ErrUnexpectedSNI, got %v", err)
+	}
+
+	server.Reset()
+	if _, err := server.TLS.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "api.example.com"}); err != nil {
+		t.Errorf("unexpected error once the expectation is removed: %v", err)
+	}
+}
+
+func TestUntrustedClientConn(t *testing.T) {
+	// The escape hatch of the default client must not leak into the untrusted one
+	server := grpctest.NewTLSServer(func(s *grpc.Server) {
+		pb.RegisterGreeterServer(s, &grpctest.GreeterServer{})
+	}, grpctest.WithClientInsecureSkipVerify())
+	defer server.Close()
+
+	_, err := pb.NewGreeterClient(server.UntrustedClientConn()).SayHello(context.Background(), &pb.HelloRequest{Name: "World"})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "certificate signed by unknown authority") {
+		t.Errorf("expected a certificate verification error, got %v", err)
+	}
+
+	plaintext := grpctest.NewServer(nil)
+	defer plaintext.Close()
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a plaintext server")
+		}
+	}()
+	plaintext.UntrustedClientConn()
+}